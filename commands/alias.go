@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli"
+
+	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/journal"
+	"github.com/vderyagin/dfm/logger"
+)
+
+// AliasAdd makes stored file available at another location in home
+// directory by creating alias to it in store and linking it.
+func AliasAdd(c *cli.Context) error {
+	if len(c.Args()) != 2 {
+		fmt.Fprintln(os.Stderr, "Exactly two arguments are expected")
+		os.Exit(1)
+	}
+
+	repo := Repo(c)
+	m := Manifest(c)
+
+	target, err := repo.ResolvePath(c.Args().Get(0))
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if !repo.IsInStore(target) {
+		for df := range repo.StoredDotFiles() {
+			if df.OriginalLocation == target && !df.IsAlias() {
+				target = df.StoredLocation
+			}
+		}
+	}
+
+	orig, err := filepath.Abs(c.Args().Get(1))
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	df, err := repo.AddAlias(target, orig)
+
+	if err != nil {
+		id, _ := filepath.Rel(repo.Home, orig)
+		logger.New(id).Fail("failed to add alias", err.Error())
+		return cli.NewMultiError(dotfile.FailErrorFrom(err))
+	}
+
+	logger := Logger(c, df)
+	logger.Success("added alias")
+
+	if err := df.Link(); err != nil {
+		logger.Fail("failed to link", err.Error())
+		return cli.NewMultiError(dotfile.FailErrorFrom(err))
+	}
+
+	m.Add(df)
+	logger.Success("linked")
+
+	if errs := SaveManifest(m, nil); len(errs) > 0 {
+		return cli.NewMultiError(errs...)
+	}
+
+	return nil
+}
+
+// AliasList displays every alias in store together with its target,
+// reporting symlinks in store that are not valid aliases.
+func AliasList(c *cli.Context) error {
+	repo := Repo(c)
+
+	for _, symlink := range repo.Aliases() {
+		id := repo.ID(symlink)
+
+		if err := repo.CheckAlias(symlink); err != nil {
+			logger.New(id).Fail("invalid alias", err.Error())
+			continue
+		}
+
+		fmt.Printf("%s -> %s\n", id, repo.ID(repo.DotFile(symlink).AliasTarget))
+	}
+
+	return nil
+}
+
+// AliasRemove removes given aliases from store together with their links in
+// home directory, keeping files they point to.
+func AliasRemove(c *cli.Context) error {
+	var errs []error
+
+	m := Manifest(c)
+
+	for _, df := range ArgDotFiles(c) {
+		logger := Logger(c, df)
+
+		if !df.IsAlias() {
+			err := dotfile.FailError("is not an alias")
+			logger.Fail("failed to remove alias", err.Error())
+			errs = append(errs, err)
+			continue
+		}
+
+		err := df.Unlink()
+
+		if _, skipped := err.(dotfile.SkipError); skipped {
+			err = nil
+		}
+
+		if err == nil {
+			m.Remove(df.OriginalLocation)
+
+			if err = journal.Remove(df.StoredLocation); err == nil {
+				err = journal.DeleteEmptyDirs(filepath.Dir(df.StoredLocation))
+			}
+		}
+
+		if err != nil {
+			logger.Fail("failed to remove alias", err.Error())
+			errs = append(errs, err)
+			continue
+		}
+
+		logger.Success("removed alias")
+	}
+
+	errs = SaveManifest(m, errs)
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return cli.NewMultiError(errs...)
+}
@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+
+	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/variant"
+)
+
+// Convert turns given stored dotfiles into their generic, host-specific,
+// force-copy or symlinked variants.
+func Convert(c *cli.Context) error {
+	EnsureArgsPresent(c)
+
+	if c.Bool("to-host-specific") && c.Bool("to-generic") ||
+		c.Bool("to-copy") && c.Bool("to-link") {
+		fmt.Fprintln(os.Stderr, "Conflicting options provided")
+		os.Exit(1)
+	}
+
+	if !(c.Bool("to-host-specific") || c.Bool("to-generic") ||
+		c.Bool("to-copy") || c.Bool("to-link")) {
+		fmt.Fprintln(os.Stderr, "No variant to convert to provided")
+		os.Exit(1)
+	}
+
+	var errs []error
+
+	m := Manifest(c)
+	repo := Repo(c)
+	selection := ArgPaths(c)
+
+	// Collect dotfiles first, as converting them changes store.
+	var dotfiles []*dotfile.DotFile
+
+	for df := range repo.StoredDotFiles() {
+		if isSelected(df, selection) {
+			dotfiles = append(dotfiles, df)
+		}
+	}
+
+	for _, df := range dotfiles {
+		logger := Logger(c, df)
+
+		hostSpecific := (df.IsFromThisHost() || c.Bool("to-host-specific")) && !c.Bool("to-generic")
+		forceCopy := (df.MustBeCopied() || c.Bool("to-copy")) && !c.Bool("to-link")
+
+		stored, err := repo.Layer(df.StoredLocation).VariantFilePath(df.OriginalLocation, hostSpecific, forceCopy)
+
+		if err != nil {
+			logger.Fail("failed to convert", err.Error())
+			errs = append(errs, err)
+			continue
+		}
+
+		if df.IsSymlinkEntry() && !forceCopy {
+			stored += variant.SymlinkSuffix
+		}
+
+		// Hard links stay such unless converted to copies or symlinks.
+		if df.MustBeHardlinked() && !c.Bool("to-copy") && !c.Bool("to-link") {
+			stored += variant.HardlinkSuffix
+		}
+
+		to := repo.DotFile(stored)
+
+		relinked, err := repo.Convert(df, to, c.Bool("force"))
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		switch err.(type) {
+		case nil:
+			if to.IsLinked() {
+				m.Add(to)
+			}
+			for _, alias := range relinked {
+				m.Add(alias)
+			}
+			logger.Success("converted to " + Logger(c, to).String())
+		case dotfile.SkipError:
+			logger.Skip("skipped converting", err.Error())
+		default:
+			logger.Fail("failed to convert", err.Error())
+		}
+	}
+
+	errs = SaveManifest(m, errs)
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return cli.NewMultiError(errs...)
+}
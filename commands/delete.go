@@ -10,25 +10,39 @@ import (
 func Delete(c *cli.Context) error {
 	var errs []error
 
-	for _, df := range ArgDotFiles(c) {
-		logger := Logger(c, df)
-
-		err := df.Delete()
-
-		if err != nil {
-			errs = append(errs, err)
+	m := Manifest(c)
+
+	for _, group := range ArgGroups(c, false) {
+		summary := Summary{Dir: group.Path}
+
+		for _, df := range group.DotFiles {
+			logger := Logger(c, df)
+
+			err := df.Delete()
+			summary.Add(err)
+
+			if err != nil {
+				errs = append(errs, err)
+			}
+
+			switch err.(type) {
+			case nil:
+				m.Remove(df.OriginalLocation)
+				logger.Success("deleted")
+			case dotfile.SkipError:
+				logger.Skip("skipped deleting", err.Error())
+			default:
+				logger.Fail("failed to delete", err.Error())
+			}
 		}
 
-		switch err.(type) {
-		case nil:
-			logger.Success("deleted")
-		case dotfile.SkipError:
-			logger.Skip("skipped deleting", err.Error())
-		default:
-			logger.Fail("failed to delete", err.Error())
+		if group.IsDir {
+			summary.Print("deleted")
 		}
 	}
 
+	errs = SaveManifest(m, errs)
+
 	if len(errs) == 0 {
 		return nil
 	}
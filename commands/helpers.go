@@ -1,24 +1,109 @@
 package commands
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/urfave/cli"
 
 	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/fsutil"
 	"github.com/vderyagin/dfm/logger"
+	"github.com/vderyagin/dfm/manifest"
 	"github.com/vderyagin/dfm/repo"
+	"github.com/vderyagin/dfm/textdiff"
+	"github.com/vderyagin/dfm/variant"
 )
 
-// Repo returns a repo.Repo object based on command line arguments.
+// Repo returns a repo.Repo object based on command line arguments, with
+// every store given layered in order.
 func Repo(c *cli.Context) *repo.Repo {
-	return repo.New(
-		c.GlobalString("store"),
+	r := repo.NewLayered(
+		c.GlobalStringSlice("store"),
 		c.GlobalString("home"),
 	)
+
+	style := linkStyle(c.GlobalString("link-style"))
+
+	for _, l := range r.Layers() {
+		l.LinkStyle = style
+	}
+
+	if into := c.String("into"); into != "" {
+		r.Target = targetStore(r, into)
+	}
+
+	return r
+}
+
+// targetStore validates store given on command line as the one to store
+// files into, exits if it is not one of stores.
+func targetStore(r *repo.Repo, store string) string {
+	if abs, err := filepath.Abs(store); err == nil {
+		for _, l := range r.Layers() {
+			if l.Store == abs {
+				return abs
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Not one of stores: %s\n", store)
+	os.Exit(1)
+
+	return ""
+}
+
+// isStoreDir returns true if given path is location of one of stores.
+func isStoreDir(r *repo.Repo, path string) bool {
+	for _, l := range r.Layers() {
+		if l.Store == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// linkStyle validates symlink style given on command line, exits if it is
+// neither absolute nor relative.
+func linkStyle(style string) string {
+	switch style {
+	case dotfile.StyleAbsolute, dotfile.StyleRelative:
+		return style
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown link style: %s (must be %s or %s)\n",
+		style, dotfile.StyleAbsolute, dotfile.StyleRelative)
+	os.Exit(1)
+
+	return ""
+}
+
+// Manifest returns manifest of files linked on this machine, stored in
+// state directory.
+func Manifest(c *cli.Context) *manifest.Manifest {
+	m, err := manifest.Load(filepath.Join(c.GlobalString("state"), "manifest.json"))
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return m
+}
+
+// SaveManifest writes manifest back, adding failure to given errors.
+func SaveManifest(m *manifest.Manifest, errs []error) []error {
+	if err := m.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save manifest: %s\n", err)
+		return append(errs, err)
+	}
+
+	return errs
 }
 
 // EnsureArgsPresent fails loudly if no command line arguments provided.
@@ -29,34 +114,361 @@ func EnsureArgsPresent(c *cli.Context) {
 	}
 }
 
-// ArgDotFiles returns a collection of DotFile objects constructed according
-// to provided command line arguments.
-func ArgDotFiles(c *cli.Context) []*dotfile.DotFile {
+// ArgGroup is a collection of dotfiles corresponding to a single command line
+// argument, which is either a file or a directory. Special holds paths of
+// files found in directory that can not be stored, Ignored is a number of
+// files skipped because of ignore patterns.
+type ArgGroup struct {
+	Path     string
+	IsDir    bool
+	DotFiles []*dotfile.DotFile
+	Special  []string
+	Ignored  int
+}
+
+// ArgGroups expands command line arguments into groups of DotFile objects.
+// Directories are expanded into dotfiles stored from under them or, when
+// storing, into every file found in them.
+func ArgGroups(c *cli.Context, storing bool) []ArgGroup {
 	EnsureArgsPresent(c)
 
+	var groups []ArgGroup
+
 	repo := Repo(c)
-	dotfiles := make([]*dotfile.DotFile, len(c.Args()))
 
-	for idx, arg := range c.Args() {
-		orig, err := filepath.Abs(arg)
+	for _, path := range ArgPaths(c) {
+		group := ArgGroup{Path: path, IsDir: fsutil.IsDir(path)}
+
+		switch {
+		case !group.IsDir:
+			group.DotFiles = []*dotfile.DotFile{argDotFile(c, path)}
+		case storing && c.Bool("fold") && !repo.IsInStore(path):
+			df := argDotFile(c, path)
+			df.Folded = true
+			group.DotFiles = []*dotfile.DotFile{df}
+		case storing && !repo.IsInStore(path):
+			collectStorable(c, &group)
+		default:
+			for df := range repo.StoredDotFiles() {
+				if isSelected(df, []string{path}) {
+					group.DotFiles = append(group.DotFiles, df)
+				}
+			}
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups
+}
+
+// collectStorable fills group with every file from its directory that can be
+// stored, skipping store itself and files matching ignore patterns.
+func collectStorable(c *cli.Context, group *ArgGroup) {
+	repo := Repo(c)
+	patterns := repo.IgnorePatterns()
 
+	filepath.Walk(group.Path, func(path string, fi os.FileInfo, err error) error {
 		if err != nil {
-			log.Fatal(err)
+			group.Special = append(group.Special, path)
+			return nil
 		}
 
-		if stored, err := repo.StoredFilePath(orig, c.Bool("host-specific"), c.Bool("copy")); err != nil {
-			log.Fatal(err)
+		if fi.IsDir() && isStoreDir(repo, path) {
+			return filepath.SkipDir
+		}
+
+		if path != group.Path && repo.IsIgnored(path, patterns) {
+			group.Ignored++
+
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if fi.IsDir() {
+			return nil
+		}
+
+		if fi.Mode().IsRegular() {
+			group.DotFiles = append(group.DotFiles, argDotFile(c, path))
+		} else if target, err := fsutil.ResolveSymlink(path); err == nil && repo.IsInStore(target) {
+			// Already linked, storing it will be reported as skipped.
+			group.DotFiles = append(group.DotFiles, argDotFile(c, path))
+		} else if err == nil && c.Bool("symlink") {
+			group.DotFiles = append(group.DotFiles, argDotFile(c, path))
 		} else {
-			dotfiles[idx] = dotfile.New(stored, orig)
+			group.Special = append(group.Special, path)
 		}
+
+		return nil
+	})
+}
+
+// argDotFile returns DotFile object for given absolute path, which is either
+// a location of stored file or a path in home directory. Paths in home
+// directory refer to dotfile used on current host (like force-copy or
+// symlink entry) unless variant is requested explicitly with flags.
+func argDotFile(c *cli.Context, path string) *dotfile.DotFile {
+	repo := Repo(c)
+
+	if repo.IsInStore(path) {
+		return repo.DotFile(path)
+	}
+
+	hostSpecific, forceCopy := c.Bool("host-specific"), c.Bool("copy")
+
+	stored, err := repo.StoredFilePath(path, hostSpecific, forceCopy)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if c.Bool("symlink") && isForeignSymlink(c, path) {
+		stored += variant.SymlinkSuffix
+	} else if c.Bool("hardlink") {
+		stored += variant.HardlinkSuffix
+	} else if !hostSpecific && !forceCopy && !fsutil.Exists(stored) {
+		if df := repo.StoredDotFile(path); df != nil {
+			return df
+		}
+	}
+
+	return repo.DotFile(stored)
+}
+
+// isForeignSymlink returns true if given path is a symlink pointing
+// somewhere outside of store.
+func isForeignSymlink(c *cli.Context, path string) bool {
+	target, err := fsutil.ResolveSymlink(path)
+
+	return err == nil && !Repo(c).IsInStore(target)
+}
+
+// ArgDotFiles returns a collection of DotFile objects constructed according
+// to provided command line arguments. Arguments can be either paths in home
+// directory or store-relative ids (including shell-style patterns matched
+// against them), in which case variant of dotfile is determined by id.
+// Directories are expanded into dotfiles stored from under them.
+func ArgDotFiles(c *cli.Context) []*dotfile.DotFile {
+	var dotfiles []*dotfile.DotFile
+
+	for _, group := range ArgGroups(c, false) {
+		dotfiles = append(dotfiles, group.DotFiles...)
 	}
 
 	return dotfiles
 }
 
+// Summary counts outcomes of an action performed on dotfiles from a single
+// directory.
+type Summary struct {
+	Dir                            string
+	Done, Skipped, Failed, Ignored int
+}
+
+// Add counts outcome of an action, given error it resulted in.
+func (s *Summary) Add(err error) {
+	switch err.(type) {
+	case nil:
+		s.Done++
+	case dotfile.SkipError:
+		s.Skipped++
+	default:
+		s.Failed++
+	}
+}
+
+// Print displays summary, done describes successful action.
+func (s *Summary) Print(done string) {
+	fmt.Printf("%s: %d %s, %d skipped, %d failed", s.Dir, s.Done, done, s.Skipped, s.Failed)
+
+	if s.Ignored > 0 {
+		fmt.Printf(", %d ignored", s.Ignored)
+	}
+
+	fmt.Println()
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// Confirm asks user given yes/no question, returns true if answer is yes.
+func Confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+
+	answer, err := stdin.ReadString('\n')
+
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+
+	return false
+}
+
+// PrintDiff displays difference between contents of two files.
+func PrintDiff(from, to string) error {
+	a, err := os.ReadFile(from)
+
+	if err != nil {
+		return err
+	}
+
+	b, err := os.ReadFile(to)
+
+	if err != nil {
+		return err
+	}
+
+	if textdiff.IsBinary(a) || textdiff.IsBinary(b) {
+		if !bytes.Equal(a, b) {
+			fmt.Printf("Binary files %s and %s differ\n", from, to)
+		}
+
+		return nil
+	}
+
+	fmt.Print(textdiff.Unified(from, to, string(a), string(b)))
+
+	return nil
+}
+
+// ArgPaths returns absolute paths corresponding to command line arguments,
+// which may be either paths or store-relative ids. Arguments matching stored
+// files as patterns are expanded.
+func ArgPaths(c *cli.Context) []string {
+	var paths []string
+
+	repo := Repo(c)
+
+	for _, arg := range c.Args() {
+		if matches := repo.Glob(arg); len(matches) > 0 {
+			paths = append(paths, matches...)
+			continue
+		}
+
+		path, err := repo.ResolvePath(arg)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths
+}
+
+// isSelected returns true if dotfile is selected by any of given paths, every
+// dotfile is selected by empty selection.
+func isSelected(df *dotfile.DotFile, selection []string) bool {
+	if len(selection) == 0 {
+		return true
+	}
+
+	for _, path := range selection {
+		if repo.Selects(df, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isDirSelected returns true if managed directory is selected by any of
+// given paths, either as a whole or partially, every directory is selected by
+// empty selection.
+func isDirSelected(md *repo.ManagedDir, selection []string) bool {
+	if len(selection) == 0 {
+		return true
+	}
+
+	for _, path := range selection {
+		for _, dir := range []string{md.Original, md.Stored} {
+			if fsutil.IsUnder(dir, path) || fsutil.IsUnder(path, dir) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// permissionsApply returns true if mode and owner of linked dotfile are
+// subject to those of managed directory. Targets of symlink entries are not
+// managed by dfm, so they are left alone.
+func permissionsApply(md *repo.ManagedDir, df *dotfile.DotFile) bool {
+	return md.Contains(df.OriginalLocation) && !df.IsSymlinkEntry() && df.IsLinked()
+}
+
+// fixPermissions brings mode and owner of directory or file in it in line
+// with declared ones, logging what got fixed.
+func fixPermissions(md *repo.ManagedDir, path string, l *logger.Logger) error {
+	drift, err := md.Drift(path)
+
+	if err == nil && len(drift) > 0 {
+		err = md.Fix(path)
+	}
+
+	if err != nil {
+		l.Fail("failed to fix permissions", err.Error())
+		return err
+	}
+
+	if len(drift) > 0 {
+		l.Success("fixed " + strings.Join(drift, ", "))
+	}
+
+	return nil
+}
+
+// reportMetadataErrors logs errors encountered reading metadata of stores,
+// returns them with metadata files identified.
+func reportMetadataErrors(r *repo.Repo) []error {
+	var errs []error
+
+	for _, l := range r.Layers() {
+		if _, err := l.Metadata(); err != nil {
+			file := filepath.Join(l.Store, repo.MetaFile)
+			logger.New(r.ID(file)).Fail("ignored malformed metadata", err.Error())
+			errs = append(errs, fmt.Errorf("%s: %s", file, err))
+		}
+	}
+
+	return errs
+}
+
+// fixMode changes mode of linked dotfile to declared one, logging what got
+// fixed.
+func fixMode(df *dotfile.DotFile, l *logger.Logger) error {
+	drift := df.ModeDrift()
+
+	if len(drift) == 0 {
+		return nil
+	}
+
+	if err := df.FixMode(); err != nil {
+		l.Fail("failed to fix mode", err.Error())
+		return err
+	}
+
+	l.Success("fixed " + strings.Join(drift, ", "))
+
+	return nil
+}
+
+// DirLogger returns a Logger object for given managed directory.
+func DirLogger(c *cli.Context, md *repo.ManagedDir) *logger.Logger {
+	return logger.New(Repo(c).ID(md.Stored) + "/")
+}
+
 // Logger returns a Logger object for given dotfile.
 func Logger(c *cli.Context, df *dotfile.DotFile) *logger.Logger {
-	repo := Repo(c)
-	id, _ := filepath.Rel(repo.Store, df.StoredLocation)
-	return logger.New(id)
+	return logger.New(Repo(c).ID(df.StoredLocation))
 }
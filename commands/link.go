@@ -1,38 +1,176 @@
 package commands
 
 import (
-	"os"
-
 	"github.com/urfave/cli"
+
+	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/journal"
 )
 
-// Link links all stored dotfiles to their respective locations in home
-// directory.
+// Link links stored dotfiles to their respective locations in home
+// directory. All dotfiles are linked unless some files or directories, either
+// in home directory or in store, are given as arguments.
 func Link(c *cli.Context) error {
-	var errs []error
+	return link(c, c.Bool("adopt"))
+}
 
-	for df := range Repo(c).StoredDotFiles() {
-		if df.IsLinked() {
+// Adopt links all stored dotfiles to their respective locations in home
+// directory, replacing files found there if they are identical to stored
+// ones.
+func Adopt(c *cli.Context) error {
+	return link(c, true)
+}
+
+func link(c *cli.Context, adopt bool) error {
+	m := Manifest(c)
+	repo := Repo(c)
+	selection := ArgPaths(c)
+
+	dirs, errs := repo.ManagedDirs()
+	errs = append(errs, reportMetadataErrors(repo)...)
+
+	for _, md := range dirs {
+		if !isDirSelected(md, selection) {
+			continue
+		}
+
+		if err := md.Create(); err != nil {
+			DirLogger(c, md).Fail("failed to create directory", err.Error())
+			errs = append(errs, err)
+		}
+	}
+
+	var linked []*dotfile.DotFile
+
+	for df := range repo.StoredDotFiles() {
+		if !isSelected(df, selection) {
 			continue
 		}
 
 		logger := Logger(c, df)
 
+		if df.IsLinked() {
+			m.Add(df)
+			linked = append(linked, df)
+
+			if err := fixMode(df, logger); err != nil {
+				errs = append(errs, err)
+			}
+
+			continue
+		}
+
+		var err error
+
+		// Switch between linking directory as a whole and linking files in
+		// it one by one if necessary. Unfolding links every file from the
+		// directory, selected or not, for none of them to get unlinked.
+		if df.Folded {
+			err = repo.Refold(df)
+		} else {
+			var (
+				dir      string
+				unfolded []*dotfile.DotFile
+			)
+
+			dir, unfolded, err = repo.Unfold(df.OriginalLocation)
+
+			if dir != "" {
+				m.Remove(dir)
+			}
+
+			for _, u := range unfolded {
+				m.Add(u)
+				linked = append(linked, u)
+				Logger(c, u).Success("linked")
+
+				if err := fixMode(u, Logger(c, u)); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+
+		if err != nil {
+			logger.Fail("failed to remove links", err.Error())
+			errs = append(errs, err)
+			continue
+		}
+
+		if df.IsLinked() {
+			continue
+		}
+
+		// Style of dotfile changed since it was linked.
+		if df.IsLinkedInOtherStyle() {
+			if err := journal.Remove(df.OriginalLocation); err != nil {
+				logger.Fail("failed to remove file", err.Error())
+				errs = append(errs, err)
+				continue
+			}
+		}
+
 		if c.Bool("force") && df.IsStored() {
-			if err := os.RemoveAll(df.OriginalLocation); err != nil {
+			if err := journal.RemoveAll(df.OriginalLocation); err != nil {
 				logger.Fail("failed to remove file", err.Error())
 				errs = append(errs, err)
 			}
 		}
 
-		if err := df.Link(); err == nil {
-			logger.Success("linked")
+		if adopt {
+			err = df.Adopt()
 		} else {
+			err = df.Link()
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		switch err.(type) {
+		case nil:
+			// Links to files of folded directory are gone now.
+			if df.Folded {
+				m.RemoveUnder(df.OriginalLocation)
+			}
+
+			m.Add(df)
+			linked = append(linked, df)
+			logger.Success("linked")
+
+			if err := fixMode(df, logger); err != nil {
+				errs = append(errs, err)
+			}
+		case dotfile.SkipError:
+			logger.Skip("skipped linking", err.Error())
+		default:
 			logger.Fail("failed to link", err.Error())
+		}
+	}
+
+	// Links are in place now, so permissions of folded directories and
+	// linked files can be fixed as well.
+	for _, md := range dirs {
+		if !isDirSelected(md, selection) {
+			continue
+		}
+
+		if err := fixPermissions(md, md.Original, DirLogger(c, md)); err != nil {
 			errs = append(errs, err)
 		}
+
+		for _, df := range linked {
+			if !permissionsApply(md, df) {
+				continue
+			}
+
+			if err := fixPermissions(md, df.OriginalLocation, Logger(c, df)); err != nil {
+				errs = append(errs, err)
+			}
+		}
 	}
 
+	errs = SaveManifest(m, errs)
+
 	if len(errs) == 0 {
 		return nil
 	}
@@ -2,17 +2,142 @@ package commands
 
 import (
 	"fmt"
-	"path/filepath"
+	"os"
+	"strings"
 
 	"github.com/urfave/cli"
+
+	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/fsutil"
+	"github.com/vderyagin/dfm/logger"
+	"github.com/vderyagin/dfm/repo"
 )
 
-// List displays a list of stored dotfiles and their states.
+// List displays a list of stored dotfiles and their states, along with
+// their attributes from store metadata if requested. Store every dotfile
+// comes from is shown when there are several of them.
 func List(c *cli.Context) error {
-	for df := range Repo(c).StoredDotFiles() {
-		id, _ := filepath.Rel(Repo(c).Store, df.StoredLocation)
+	repo := Repo(c)
+	dirs, errs := repo.ManagedDirs()
+	layered := len(repo.Layers()) > 1
+
+	reportMetadataErrors(repo)
+
+	for df := range repo.StoredDotFiles() {
+		id := repo.ID(df.StoredLocation)
+
+		if df.Folded {
+			id += "/"
+		}
+
+		if df.IsAlias() {
+			id += " -> " + repo.ID(df.AliasTarget)
+		}
+
+		if df.IsSymlinkEntry() {
+			id += " => " + symlinkDescription(df)
+		}
+
+		if layered {
+			id += " (" + repo.Layer(df.StoredLocation).Store + ")"
+		}
+
 		fmt.Printf("%23s %s\n", df.CurrentState().ColorString(), id)
+
+		if c.Bool("long") {
+			printMeta(repo.Meta(df.StoredLocation))
+		}
+
+		if drift := df.ModeDrift(); len(drift) > 0 {
+			Logger(c, df).Warn("mode drift", strings.Join(drift, ", "))
+		}
+
+		for _, md := range dirs {
+			if permissionsApply(md, df) {
+				reportDrift(md, df.OriginalLocation, Logger(c, df))
+			}
+		}
+	}
+
+	for _, md := range dirs {
+		reportDrift(md, md.Original, DirLogger(c, md))
+	}
+
+	for _, err := range errs {
+		reportSettingsError(err)
+	}
+
+	for _, l := range repo.Layers() {
+		for path := range fsutil.FilesIn(l.Store) {
+			if _, err := l.Variant(path); err != nil {
+				logger.New(l.ID(path)).Fail("ignored file with malformed name", err.Error())
+			}
+		}
 	}
 
 	return nil
 }
+
+// printMeta prints attributes of stored file, one group per line.
+func printMeta(m repo.Meta) {
+	var attrs []string
+
+	if m.Mode != "" {
+		attrs = append(attrs, "mode "+m.Mode)
+	}
+
+	if m.Style != "" {
+		attrs = append(attrs, "style "+m.Style)
+	}
+
+	if m.App != "" {
+		attrs = append(attrs, "app "+m.App)
+	}
+
+	if len(m.Tags) > 0 {
+		attrs = append(attrs, "tags "+strings.Join(m.Tags, ", "))
+	}
+
+	if len(attrs) > 0 {
+		fmt.Printf("\t%s\n", strings.Join(attrs, "; "))
+	}
+
+	if m.Description != "" {
+		fmt.Printf("\t%s\n", m.Description)
+	}
+}
+
+// reportSettingsError logs malformed settings of stored directory.
+func reportSettingsError(err error) {
+	if e, ok := err.(repo.DirSettingsError); ok {
+		logger.New(e.Dir+"/").Fail("ignored malformed directory settings", e.Reason)
+	}
+}
+
+// reportDrift logs differences between mode and owner of directory or file
+// in it and declared ones.
+func reportDrift(md *repo.ManagedDir, path string, l *logger.Logger) {
+	drift, err := md.Drift(path)
+
+	if err != nil {
+		l.Fail("failed to check permissions", err.Error())
+	} else if len(drift) > 0 {
+		l.Warn("permission drift", strings.Join(drift, ", "))
+	}
+}
+
+// symlinkDescription returns target recorded for symlink entry, along with
+// current target of symlink at original location if it differs.
+func symlinkDescription(df *dotfile.DotFile) string {
+	recorded, err := df.RecordedTarget()
+
+	if err != nil {
+		return "?"
+	}
+
+	if current, err := os.Readlink(df.OriginalLocation); err == nil && current != recorded {
+		return fmt.Sprintf("%s (currently %s)", recorded, current)
+	}
+
+	return recorded
+}
@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/vderyagin/dfm/fsutil"
+	"github.com/vderyagin/dfm/journal"
+)
+
+// timeFormats maps accepted formats of time to functions returning start of
+// period following the one given time denotes.
+var timeFormats = []struct {
+	layout string
+	next   func(time.Time) time.Time
+}{
+	{time.RFC3339, func(t time.Time) time.Time { return t.Add(time.Second) }},
+	{"2006-01-02 15:04:05", func(t time.Time) time.Time { return t.Add(time.Second) }},
+	{"2006-01-02 15:04", func(t time.Time) time.Time { return t.Add(time.Minute) }},
+	{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+}
+
+// parseTime returns the first and the last moments of period given time
+// denotes, like a whole day for a date.
+func parseTime(input string) (start, end time.Time, err error) {
+	for _, format := range timeFormats {
+		if t, err := time.ParseInLocation(format.layout, input, time.Local); err == nil {
+			return t, format.next(t).Add(-time.Nanosecond), nil
+		}
+	}
+
+	return time.Time{}, time.Time{}, fmt.Errorf("can not parse time: %s", input)
+}
+
+// Log displays journal entries, optionally limited to given files and time
+// range.
+func Log(c *cli.Context) error {
+	var since, until time.Time
+	var err error
+
+	if c.IsSet("since") {
+		if since, _, err = parseTime(c.String("since")); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	if c.IsSet("until") {
+		if _, until, err = parseTime(c.String("until")); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	var files []string
+
+	for _, arg := range c.Args() {
+		path, err := filepath.Abs(arg)
+
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		files = append(files, path)
+	}
+
+	entries, err := journal.Current().Entries()
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	for _, e := range entries {
+		if !since.IsZero() && e.Time.Before(since) {
+			continue
+		}
+
+		if !until.IsZero() && e.Time.After(until) {
+			continue
+		}
+
+		if len(files) > 0 && !entryConcerns(e, files) {
+			continue
+		}
+
+		printEntry(e)
+	}
+
+	return nil
+}
+
+func entryConcerns(e journal.Entry, files []string) bool {
+	for _, file := range files {
+		if fsutil.IsUnder(e.Path, file) || (e.Source != "" && fsutil.IsUnder(e.Source, file)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func printEntry(e journal.Entry) {
+	line := fmt.Sprintf("%s %-7s %s", e.Time.Local().Format("2006-01-02 15:04:05"), e.Op, e.Path)
+
+	switch e.Op {
+	case journal.OpSymlink:
+		line += " -> " + e.Source
+	case journal.OpRename, journal.OpCopy, journal.OpHardlink:
+		line += " <- " + e.Source
+	case journal.OpChmod, journal.OpChown:
+		line += " (was " + e.Previous + ")"
+	case journal.OpUndo:
+		line += e.Undoes + ", " + e.Previous + " change(s) reverted"
+	}
+
+	if e.Previous == "" && (e.Before != "" || e.After != "") {
+		line += fmt.Sprintf("\n\t[%s => %s]", describeFingerprint(e.Before), describeFingerprint(e.After))
+	}
+
+	fmt.Printf("%s\n\t(%s on %s)\n", line, strings.Join(e.Command, " "), e.Host)
+}
+
+func describeFingerprint(fp string) string {
+	if fp == "" {
+		return "none"
+	}
+
+	return fp
+}
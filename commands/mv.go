@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+
+	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/logger"
+)
+
+// Move renames or relocates stored dotfile, with all its variants and
+// aliases pointing to it.
+func Move(c *cli.Context) error {
+	if len(c.Args()) != 2 {
+		fmt.Fprintln(os.Stderr, "Exactly two arguments are expected")
+		os.Exit(1)
+	}
+
+	repo := Repo(c)
+	m := Manifest(c)
+
+	var origs []string
+
+	for _, arg := range c.Args() {
+		path, err := repo.ResolvePath(arg)
+
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		if repo.IsInStore(path) {
+			path = repo.OriginalFilePath(path)
+		}
+
+		origs = append(origs, path)
+	}
+
+	oldID, _ := filepath.Rel(repo.Home, origs[0])
+	newID, _ := filepath.Rel(repo.Home, origs[1])
+	logger := logger.New(strings.TrimPrefix(oldID, ".") + " -> " + strings.TrimPrefix(newID, "."))
+
+	relinked, err := repo.Move(origs[0], origs[1])
+
+	if err != nil {
+		logger.Fail("failed to move", err.Error())
+		return cli.NewMultiError(dotfile.FailErrorFrom(err))
+	}
+
+	m.Remove(origs[0])
+
+	for _, df := range relinked {
+		m.Add(df)
+	}
+
+	errs := SaveManifest(m, nil)
+
+	logger.Success("moved")
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return cli.NewMultiError(errs...)
+}
@@ -0,0 +1,140 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+
+	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/fsutil"
+	"github.com/vderyagin/dfm/textdiff"
+	"github.com/vderyagin/dfm/variant"
+)
+
+// Promote makes host-specific variants of given dotfiles generic ones,
+// either replacing generic stored files or merging changes into them
+// interactively.
+func Promote(c *cli.Context) error {
+	EnsureArgsPresent(c)
+
+	var errs []error
+	var dotfiles []*dotfile.DotFile
+
+	m := Manifest(c)
+	repo := Repo(c)
+	selection := ArgPaths(c)
+
+	for df := range repo.StoredDotFiles() {
+		if isSelected(df, selection) {
+			dotfiles = append(dotfiles, df)
+		}
+	}
+
+	for _, df := range dotfiles {
+		logger := Logger(c, df)
+
+		stored, err := repo.Layer(df.StoredLocation).VariantFilePath(df.OriginalLocation, false, df.MustBeCopied())
+
+		if err != nil {
+			logger.Fail("failed to promote", err.Error())
+			errs = append(errs, err)
+			continue
+		}
+
+		if df.IsSymlinkEntry() {
+			stored += variant.SymlinkSuffix
+		}
+
+		generic := repo.DotFile(stored)
+
+		var content []byte
+
+		if c.Bool("interactive") && df.IsFromThisHost() && fsutil.IsRegularFile(generic.StoredLocation) {
+			if content, err = mergeInteractively(generic.StoredLocation, df.StoredLocation); err != nil {
+				logger.Fail("failed to merge", err.Error())
+				errs = append(errs, err)
+				continue
+			}
+		}
+
+		err = df.Promote(generic, content)
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		switch err.(type) {
+		case nil:
+			if generic.IsLinked() {
+				m.Add(generic)
+			}
+			logger.Success("promoted")
+		case dotfile.SkipError:
+			logger.Skip("skipped promoting", err.Error())
+		default:
+			logger.Fail("failed to promote", err.Error())
+		}
+
+		if err != nil {
+			continue
+		}
+
+		for _, path := range repo.Variants(df.OriginalLocation) {
+			if v, err := repo.Variant(path); err == nil && !v.IsGeneric() {
+				logger.Warn("still overridden", "by "+repo.ID(path)+" on other host")
+			}
+		}
+	}
+
+	errs = SaveManifest(m, errs)
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return cli.NewMultiError(errs...)
+}
+
+// mergeInteractively asks user about every change between files from and
+// to, returns content of from with accepted changes applied.
+func mergeInteractively(from, to string) ([]byte, error) {
+	a, err := os.ReadFile(from)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(to)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(a, b) {
+		return nil, nil
+	}
+
+	if textdiff.IsBinary(a) || textdiff.IsBinary(b) {
+		return nil, errors.New("binary files can not be merged")
+	}
+
+	fmt.Printf("--- %s\n+++ %s\n", from, to)
+
+	merged := textdiff.Merge(string(a), string(b), func(change []textdiff.Line) bool {
+		for _, l := range change {
+			fmt.Printf("%c%s", l.Kind, l.Text)
+
+			if !strings.HasSuffix(l.Text, "\n") {
+				fmt.Println()
+			}
+		}
+
+		return Confirm("Apply this change?")
+	})
+
+	return []byte(merged), nil
+}
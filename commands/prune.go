@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"path/filepath"
+
+	"github.com/urfave/cli"
+
+	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/fsutil"
+	"github.com/vderyagin/dfm/journal"
+	"github.com/vderyagin/dfm/logger"
+	"github.com/vderyagin/dfm/manifest"
+)
+
+// Prune removes symlinks and copies created by dfm in home directory that
+// are no longer backed by files in store.
+func Prune(c *cli.Context) error {
+	var errs []error
+
+	repo := Repo(c)
+	m := Manifest(c)
+
+	var stored []*dotfile.DotFile
+
+	for df := range repo.StoredDotFiles() {
+		stored = append(stored, df)
+	}
+
+	var orphans []manifest.Entry
+
+	for _, l := range repo.Layers() {
+		orphans = append(orphans, m.Orphans(l.Store, stored)...)
+	}
+
+	for _, e := range orphans {
+		logger := logger.New(repo.ID(e.Stored))
+
+		if !fsutil.Exists(e.Original) {
+			if !c.Bool("dry-run") {
+				m.Remove(e.Original)
+			}
+			continue
+		}
+
+		if !e.IsUnmodified() {
+			logger.Skip("skipped pruning", "changed since it was linked: "+e.Original)
+			continue
+		}
+
+		if c.Bool("dry-run") {
+			logger.Success("would prune")
+			continue
+		}
+
+		if err := journal.Remove(e.Original); err != nil {
+			logger.Fail("failed to prune", err.Error())
+			errs = append(errs, err)
+			continue
+		}
+
+		m.Remove(e.Original)
+
+		if err := journal.DeleteEmptyDirs(filepath.Dir(e.Original)); err != nil {
+			logger.Fail("failed to remove empty directories", err.Error())
+			errs = append(errs, err)
+			continue
+		}
+
+		logger.Success("pruned")
+	}
+
+	if !c.Bool("dry-run") {
+		errs = SaveManifest(m, errs)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return cli.NewMultiError(errs...)
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"github.com/urfave/cli"
+
+	"github.com/vderyagin/dfm/dotfile"
+)
+
+// Reabsorb moves regular files that replaced symlinks to stored dotfiles
+// into store and links them back. Works on given files or on every replaced
+// dotfile if none are given.
+func Reabsorb(c *cli.Context) error {
+	var errs []error
+	var dotfiles []*dotfile.DotFile
+
+	m := Manifest(c)
+
+	if c.Args().Present() {
+		dotfiles = ArgDotFiles(c)
+	} else {
+		for df := range Repo(c).StoredDotFiles() {
+			if df.IsReplaced() {
+				dotfiles = append(dotfiles, df)
+			}
+		}
+	}
+
+	for _, df := range dotfiles {
+		logger := Logger(c, df)
+
+		if df.IsReplaced() {
+			// Aliases get their target files rewritten.
+			stored := df.StoredLocation
+
+			if df.IsAlias() {
+				stored = df.AliasTarget
+			}
+
+			if err := PrintDiff(stored, df.OriginalLocation); err != nil {
+				logger.Fail("failed to compare", err.Error())
+				errs = append(errs, err)
+				continue
+			}
+
+			if c.Bool("interactive") && !Confirm("Reabsorb "+df.OriginalLocation+"?") {
+				logger.Skip("skipped reabsorbing", "declined")
+				continue
+			}
+		}
+
+		err := df.Reabsorb()
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		switch err.(type) {
+		case nil:
+			m.Add(df)
+			logger.Success("reabsorbed")
+		case dotfile.SkipError:
+			logger.Skip("skipped reabsorbing", err.Error())
+		default:
+			logger.Fail("failed to reabsorb", err.Error())
+		}
+	}
+
+	errs = SaveManifest(m, errs)
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return cli.NewMultiError(errs...)
+}
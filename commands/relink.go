@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"github.com/urfave/cli"
+
+	"github.com/vderyagin/dfm/dotfile"
+)
+
+// Relink replaces symlinks to stored files with equivalent ones of given
+// style (absolute or relative), or of style every dotfile is supposed to be
+// linked in if none given. All linked dotfiles are relinked unless some files
+// or directories are given as arguments.
+func Relink(c *cli.Context) error {
+	var errs []error
+
+	m := Manifest(c)
+	repo := Repo(c)
+	selection := ArgPaths(c)
+
+	style := ""
+
+	if c.IsSet("style") {
+		style = linkStyle(c.String("style"))
+	}
+
+	for df := range repo.StoredDotFiles() {
+		if !isSelected(df, selection) {
+			continue
+		}
+
+		logger := Logger(c, df)
+
+		relative := df.Style == dotfile.StyleRelative
+
+		if style != "" {
+			relative = style == dotfile.StyleRelative
+		}
+
+		err := df.Relink(relative)
+
+		// Files that need no relinking are of no interest when relinking
+		// everything.
+		if _, skipped := err.(dotfile.SkipError); skipped && len(selection) == 0 {
+			continue
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		switch err.(type) {
+		case nil:
+			m.Add(df)
+			logger.Success("relinked")
+		case dotfile.SkipError:
+			logger.Skip("skipped relinking", err.Error())
+		default:
+			logger.Fail("failed to relink", err.Error())
+		}
+	}
+
+	errs = SaveManifest(m, errs)
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return cli.NewMultiError(errs...)
+}
@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/urfave/cli"
+
+	"github.com/vderyagin/dfm/dotfile"
+)
+
+// Relocate repoints symlinks to files in stores that were moved from their
+// former locations (given or guessed from existing symlinks) to the same
+// files in stores' current locations. All stored dotfiles are relocated
+// unless some files or directories are given as arguments.
+func Relocate(c *cli.Context) error {
+	var errs []error
+
+	m := Manifest(c)
+	repo := Repo(c)
+	selection := ArgPaths(c)
+
+	from := ""
+
+	if c.IsSet("from") {
+		abs, err := filepath.Abs(c.String("from"))
+
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		from = abs
+	}
+
+	// Former locations, keyed by current ones.
+	former := make(map[string]string)
+
+	if from == "" {
+		former = repo.FormerStores()
+	}
+
+	for _, l := range repo.Layers() {
+		if from != "" && from != l.Store {
+			former[l.Store] = from
+		}
+	}
+
+	if len(former) == 0 && from != "" {
+		return cli.NewExitError(fmt.Sprintf("store is already located at %s", from), 1)
+	} else if len(former) == 0 {
+		return cli.NewExitError("failed to find former location of store, specify it with --from", 1)
+	}
+
+	for df := range repo.StoredDotFiles() {
+		l := repo.Layer(df.StoredLocation)
+		oldStore, ok := former[l.Store]
+
+		if !ok || !isSelected(df, selection) {
+			continue
+		}
+
+		logger := Logger(c, df)
+
+		_, err := l.Relocate(df.OriginalLocation, oldStore)
+
+		// Files linked elsewhere are of no interest when relocating
+		// everything.
+		if _, skipped := err.(dotfile.SkipError); skipped && len(selection) == 0 {
+			continue
+		}
+
+		if _, skipped := err.(dotfile.SkipError); err != nil && !skipped {
+			err = dotfile.FailErrorFrom(err)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		switch err.(type) {
+		case nil:
+			m.Add(df)
+			logger.Success("relocated")
+		case dotfile.SkipError:
+			logger.Skip("skipped relocating", err.Error())
+		default:
+			logger.Fail("failed to relocate", err.Error())
+		}
+	}
+
+	errs = SaveManifest(m, errs)
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return cli.NewMultiError(errs...)
+}
@@ -1,31 +1,80 @@
 package commands
 
 import (
+	"fmt"
+	"sort"
+
 	"github.com/urfave/cli"
+
 	"github.com/vderyagin/dfm/dotfile"
 )
 
+var variantFilters = map[string]func(*dotfile.DotFile) bool{
+	"generic":       (*dotfile.DotFile).IsGeneric,
+	"host-specific": (*dotfile.DotFile).IsFromThisHost,
+	"copy":          (*dotfile.DotFile).MustBeCopied,
+	"alias":         (*dotfile.DotFile).IsAlias,
+}
+
 // Restore moves dotfiles from store back to its original location, makes
-// sense only for linked files.
+// sense only for linked files. With --all flag restores every stored file,
+// optionally only of given variant.
 func Restore(c *cli.Context) error {
 	var errs []error
+	var groups []ArgGroup
+	var failed []string
 
-	for _, df := range ArgDotFiles(c) {
-		logger := Logger(c, df)
+	m := Manifest(c)
 
-		err := df.Restore()
+	if c.Bool("all") {
+		all, err := allForRestoring(c)
 
 		if err != nil {
-			errs = append(errs, err)
+			return cli.NewExitError(err.Error(), 1)
 		}
 
-		switch err.(type) {
-		case nil:
-			logger.Success("restored")
-		case dotfile.SkipError:
-			logger.Skip("skipped restoring", err.Error())
-		default:
-			logger.Fail("failed to restore", err.Error())
+		groups = append(groups, all)
+	} else {
+		groups = ArgGroups(c, false)
+	}
+
+	for _, group := range groups {
+		summary := Summary{Dir: group.Path}
+
+		for _, df := range group.DotFiles {
+			logger := Logger(c, df)
+
+			err := df.Restore()
+			summary.Add(err)
+
+			if err != nil {
+				errs = append(errs, err)
+			}
+
+			switch err.(type) {
+			case nil:
+				m.Remove(df.OriginalLocation)
+				logger.Success("restored")
+			case dotfile.SkipError:
+				logger.Skip("skipped restoring", err.Error())
+			default:
+				logger.Fail("failed to restore", err.Error())
+				failed = append(failed, fmt.Sprintf("%s (%s)", logger, err))
+			}
+		}
+
+		if group.IsDir {
+			summary.Print("restored")
+		}
+	}
+
+	errs = SaveManifest(m, errs)
+
+	if c.Bool("all") && len(failed) > 0 {
+		fmt.Println("Could not restore:")
+
+		for _, f := range failed {
+			fmt.Printf("\t%s\n", f)
 		}
 	}
 
@@ -35,3 +84,32 @@ func Restore(c *cli.Context) error {
 
 	return cli.NewMultiError(errs...)
 }
+
+// allForRestoring returns every stored dotfile of variant requested with
+// --only flag. Aliases go first, as they can not be restored after their
+// targets are moved out of store.
+func allForRestoring(c *cli.Context) (ArgGroup, error) {
+	var all ArgGroup
+
+	filter := func(*dotfile.DotFile) bool { return true }
+
+	if c.IsSet("only") {
+		var ok bool
+
+		if filter, ok = variantFilters[c.String("only")]; !ok {
+			return all, fmt.Errorf("unknown variant: %s", c.String("only"))
+		}
+	}
+
+	for df := range Repo(c).StoredDotFiles() {
+		if filter(df) {
+			all.DotFiles = append(all.DotFiles, df)
+		}
+	}
+
+	sort.SliceStable(all.DotFiles, func(i, j int) bool {
+		return all.DotFiles[i].IsAlias() && !all.DotFiles[j].IsAlias()
+	})
+
+	return all, nil
+}
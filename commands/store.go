@@ -1,44 +1,72 @@
 package commands
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/urfave/cli"
 
 	"github.com/vderyagin/dfm/dotfile"
 	"github.com/vderyagin/dfm/fsutil"
+	"github.com/vderyagin/dfm/journal"
+	"github.com/vderyagin/dfm/logger"
 )
 
-// Store stores and links back given files.
+// Store stores and links back given files, directories are stored file by
+// file.
 func Store(c *cli.Context) error {
 	var errs []error
 
-	for _, df := range ArgDotFiles(c) {
-		logger := Logger(c, df)
+	if c.Bool("copy") && c.Bool("hardlink") {
+		fmt.Fprintln(os.Stderr, "Conflicting options provided")
+		os.Exit(1)
+	}
 
-		if c.Bool("force") && fsutil.IsRegularFile(df.OriginalLocation) {
-			if err := os.RemoveAll(df.StoredLocation); err != nil {
-				logger.Fail("failed to remove file", err.Error())
-				errs = append(errs, err)
-			}
+	m := Manifest(c)
+
+	for _, group := range ArgGroups(c, true) {
+		summary := Summary{Dir: group.Path, Ignored: group.Ignored}
+
+		for _, path := range group.Special {
+			logger.New(path).Skip("skipped storing", "not a regular file")
+			summary.Skipped++
 		}
 
-		err := df.Store()
+		for _, df := range group.DotFiles {
+			logger := Logger(c, df)
+
+			if c.Bool("force") && fsutil.IsRegularFile(df.OriginalLocation) {
+				if err := journal.RemoveAll(df.StoredLocation); err != nil {
+					logger.Fail("failed to remove file", err.Error())
+					errs = append(errs, err)
+				}
+			}
 
-		if err != nil {
-			errs = append(errs, err)
+			err := df.Store()
+			summary.Add(err)
+
+			if err != nil {
+				errs = append(errs, err)
+			}
+
+			switch err.(type) {
+			case nil:
+				m.Add(df)
+				logger.Success("stored")
+			case dotfile.SkipError:
+				logger.Skip("skipped storing", err.Error())
+			default:
+				logger.Fail("failed to store", err.Error())
+			}
 		}
 
-		switch err.(type) {
-		case nil:
-			logger.Success("stored")
-		case dotfile.SkipError:
-			logger.Skip("skipped storing", err.Error())
-		default:
-			logger.Fail("failed to store", err.Error())
+		if group.IsDir {
+			summary.Print("stored")
 		}
 	}
 
+	errs = SaveManifest(m, errs)
+
 	if len(errs) == 0 {
 		return nil
 	}
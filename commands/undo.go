@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli"
+
+	"github.com/vderyagin/dfm/journal"
+	"github.com/vderyagin/dfm/logger"
+)
+
+// Undo reverts changes made during most recent run of dfm that was not
+// undone yet.
+func Undo(c *cli.Context) error {
+	runs, err := journal.Current().UndoableRuns()
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if c.Bool("list") {
+		for _, run := range runs {
+			partially := ""
+
+			if run.Reverted > 0 {
+				partially = fmt.Sprintf(" (%d undone)", run.Reverted)
+			}
+
+			fmt.Printf("%s %3d change(s)%s %s\n",
+				run.Time.Local().Format("2006-01-02 15:04:05"),
+				len(run.Entries),
+				partially,
+				strings.Join(run.Command, " "))
+		}
+
+		return nil
+	}
+
+	if len(runs) == 0 {
+		fmt.Println("Nothing to undo")
+		return nil
+	}
+
+	run := runs[0]
+	logger := logger.New(strings.Join(run.Command, " "))
+
+	if err := journal.Undo(run); err != nil {
+		logger.Fail("failed to undo", err.Error())
+		return cli.NewExitError("", 1)
+	}
+
+	logger.Success("undone")
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"github.com/urfave/cli"
+
+	"github.com/vderyagin/dfm/dotfile"
+)
+
+// Unlink removes links to stored files from home directory, leaving store
+// intact. Works on given files and directories or on every stored file with
+// --all flag.
+func Unlink(c *cli.Context) error {
+	var errs []error
+	var groups []ArgGroup
+
+	m := Manifest(c)
+
+	if c.Bool("all") {
+		var all ArgGroup
+
+		for df := range Repo(c).StoredDotFiles() {
+			all.DotFiles = append(all.DotFiles, df)
+		}
+
+		groups = append(groups, all)
+	} else {
+		groups = ArgGroups(c, false)
+	}
+
+	for _, group := range groups {
+		summary := Summary{Dir: group.Path}
+
+		for _, df := range group.DotFiles {
+			logger := Logger(c, df)
+
+			err := df.Unlink()
+
+			// Files that are not linked at all are of no interest when
+			// unlinking everything.
+			if _, skipped := err.(dotfile.SkipError); skipped && c.Bool("all") {
+				continue
+			}
+
+			summary.Add(err)
+
+			if err != nil {
+				errs = append(errs, err)
+			}
+
+			switch err.(type) {
+			case nil:
+				m.Remove(df.OriginalLocation)
+				logger.Success("unlinked")
+			case dotfile.SkipError:
+				logger.Skip("skipped unlinking", err.Error())
+			default:
+				logger.Fail("failed to unlink", err.Error())
+			}
+		}
+
+		if group.IsDir {
+			summary.Print("unlinked")
+		}
+	}
+
+	errs = SaveManifest(m, errs)
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return cli.NewMultiError(errs...)
+}
@@ -2,14 +2,19 @@ package dotfile
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"syscall"
 
 	"github.com/vderyagin/dfm/fsutil"
 	"github.com/vderyagin/dfm/host"
+	"github.com/vderyagin/dfm/journal"
+	"github.com/vderyagin/dfm/textdiff"
+	"github.com/vderyagin/dfm/variant"
 )
 
 type SkipError string
@@ -36,16 +41,41 @@ func FailErrorFrom(e error) FailError {
 	return FailError(e.Error())
 }
 
+// DirFile is a name of file in stored directory holding its settings, one
+// directive per line.
+const DirFile = ".dfmdir"
+
+// FoldDirective in DirFile makes directory folded.
+const FoldDirective = "fold"
+
+// Link styles that can be declared for dotfiles in store metadata. Symlinks
+// are absolute or relative (pointing to stored file from original location),
+// StyleSymlink stands for default form of them.
+const (
+	StyleSymlink  = "symlink"
+	StyleAbsolute = "absolute"
+	StyleRelative = "relative"
+	StyleCopy     = "copy"
+	StyleHardlink = "hardlink"
+)
+
 // DotFile type represents a single dotfile, defined by its storage and
 // linking location. If dotfile is stored, its StoredLocation corresponds to a
 // file within dotfiles repository and OriginalLocation - to symlink in user
 // home directory where system expects original file to be.
 // If StoredLocation is a relative symlink within the store (an alias),
 // AliasTarget contains the resolved absolute path of the target file.
+// Folded dotfiles are whole directories, linked with a single symlink.
+// Style and Mode come from store metadata: link style overriding the one
+// implied by file name (force-copy files are copied regardless) and mode
+// stored file should have, zero if not declared.
 type DotFile struct {
 	StoredLocation   string
 	OriginalLocation string
 	AliasTarget      string
+	Folded           bool
+	Style            string
+	Mode             os.FileMode
 }
 
 // New returns a pointer to a DotFile object. Paths passed as arguments must
@@ -66,6 +96,9 @@ func (df *DotFile) IsStored() bool {
 	if df.IsAlias() {
 		return fsutil.IsSymlink(df.StoredLocation) && fsutil.IsRegularFile(df.AliasTarget)
 	}
+	if df.Folded {
+		return fsutil.IsDir(df.StoredLocation)
+	}
 	return fsutil.IsRegularFile(df.StoredLocation)
 }
 
@@ -76,31 +109,45 @@ func (df *DotFile) IsLinked() bool {
 		return false
 	}
 
+	if df.MustBeHardlinked() {
+		return fsutil.IsRegularFile(df.OriginalLocation) && isSameFile(df.OriginalLocation, df.storedFile())
+	}
+
 	if df.MustBeCopied() {
 		if !(fsutil.IsRegularFile(df.OriginalLocation) &&
-			fsutil.IsRegularFile(df.StoredLocation)) {
+			fsutil.IsRegularFile(df.storedFile())) {
 			return false
 		}
 
-		re := regexp.MustCompile(`\.force-copy`)
-		if fsutil.Exists(re.ReplaceAllLiteralString(df.StoredLocation, "")) {
+		// Hard link to stored file is not a copy of it.
+		if isSameFile(df.OriginalLocation, df.storedFile()) {
 			return false
 		}
 
-		originalMD5, err1 := fsutil.MD5(df.OriginalLocation)
-		storedMD5, err2 := fsutil.MD5(df.StoredLocation)
-
-		if err1 != nil || err2 != nil {
-			return false
+		if v, err := variant.Parse(df.StoredLocation); err == nil && v.IsCopy() && !df.IsAlias() {
+			if fsutil.Exists(v.WithoutCopy().Path()) {
+				return false
+			}
 		}
 
-		return bytes.Compare(originalMD5, storedMD5) == 0
+		same, err := fsutil.SameContent(df.OriginalLocation, df.storedFile())
+
+		return err == nil && same
 	}
 
 	if !fsutil.IsSymlink(df.OriginalLocation) {
 		return false
 	}
 
+	if df.IsSymlinkEntry() {
+		recorded, err := df.RecordedTarget()
+		if err != nil {
+			return false
+		}
+		target, err := os.Readlink(df.OriginalLocation)
+		return err == nil && target == recorded
+	}
+
 	if df.IsAlias() {
 		resolved, err := fsutil.ResolveSymlink(df.OriginalLocation)
 		if err != nil {
@@ -119,8 +166,36 @@ func (df *DotFile) IsLinked() bool {
 	return os.SameFile(origLinkTargetInfo, storedInfo)
 }
 
+// IsReplaced returns true if symlink at original location got replaced by a
+// regular file, which is what some applications do when saving files: file
+// at original location differs from stored one, which is older.
+func (df *DotFile) IsReplaced() bool {
+	if df.MustBeCopied() || df.IsSymlinkEntry() || !df.IsStored() || !fsutil.IsRegularFile(df.OriginalLocation) {
+		return false
+	}
+
+	origInfo, err := os.Stat(df.OriginalLocation)
+	if err != nil {
+		return false
+	}
+
+	storedInfo, err := os.Stat(df.storedFile())
+	if err != nil {
+		return false
+	}
+
+	if origInfo.ModTime().Before(storedInfo.ModTime()) {
+		return false
+	}
+
+	same, err := fsutil.SameContent(df.OriginalLocation, df.storedFile())
+
+	return err == nil && !same
+}
+
 // IsReadyToBeStored returns true if dotfile is ready to be stored, that is if
-// it is a regular file not conflicting with any of already stored files.
+// it is a regular file (directory for folded dotfiles, symlink for symlink
+// entries) not conflicting with any of already stored files.
 func (df *DotFile) IsReadyToBeStored() bool {
 	origInfo, err := os.Lstat(df.OriginalLocation)
 
@@ -128,7 +203,16 @@ func (df *DotFile) IsReadyToBeStored() bool {
 		return false
 	}
 
-	if !origInfo.Mode().IsRegular() {
+	switch {
+	case df.Folded:
+		if !origInfo.IsDir() {
+			return false
+		}
+	case df.IsSymlinkEntry():
+		if origInfo.Mode()&os.ModeSymlink == 0 {
+			return false
+		}
+	case !origInfo.Mode().IsRegular():
 		return false
 	}
 
@@ -149,22 +233,52 @@ func (df *DotFile) Store() error {
 		return FailError("can not be stored")
 	}
 
-	if err := os.MkdirAll(filepath.Dir(df.StoredLocation), 0777); err != nil {
+	if df.Folded && df.MustBeCopied() {
+		return FailError("folded directories can not be copied")
+	}
+
+	if err := journal.MkdirAll(filepath.Dir(df.StoredLocation), 0777); err != nil {
 		return FailErrorFrom(err)
 	}
 
 	if df.MustBeCopied() {
-		if err := fsutil.CopyFile(df.OriginalLocation, df.StoredLocation); err != nil {
+		if err := journal.CopyFile(df.OriginalLocation, df.StoredLocation); err != nil {
 			return FailErrorFrom(err)
 		}
 		return nil
 	}
 
-	if err := os.Rename(df.OriginalLocation, df.StoredLocation); err != nil {
+	if df.MustBeHardlinked() {
+		if err := journal.Link(df.OriginalLocation, df.StoredLocation); err != nil {
+			return hardlinkError(err)
+		}
+		return nil
+	}
+
+	if df.IsSymlinkEntry() {
+		target, err := os.Readlink(df.OriginalLocation)
+		if err != nil {
+			return FailErrorFrom(err)
+		}
+		if err := journal.WriteFile(df.StoredLocation, []byte(target+"\n"), 0666); err != nil {
+			return FailErrorFrom(err)
+		}
+		return nil
+	}
+
+	if err := journal.Rename(df.OriginalLocation, df.StoredLocation); err != nil {
 		return FailErrorFrom(err)
 	}
 
-	if err := os.Symlink(df.StoredLocation, df.OriginalLocation); err != nil {
+	if df.Folded {
+		dirFile := filepath.Join(df.StoredLocation, DirFile)
+
+		if err := journal.WriteFile(dirFile, []byte(FoldDirective+"\n"), 0666); err != nil {
+			return FailErrorFrom(err)
+		}
+	}
+
+	if err := journal.Symlink(df.LinkTarget(), df.OriginalLocation); err != nil {
 		return FailErrorFrom(err)
 	}
 
@@ -185,22 +299,169 @@ func (df *DotFile) Link() error {
 		return FailError("conflicting file at original location")
 	}
 
-	if err := os.MkdirAll(filepath.Dir(df.OriginalLocation), 0777); err != nil {
+	if err := journal.MkdirAll(filepath.Dir(df.OriginalLocation), 0777); err != nil {
 		return FailErrorFrom(err)
 	}
 
 	if df.MustBeCopied() {
-		if err := fsutil.CopyFile(df.StoredLocation, df.OriginalLocation); err != nil {
+		if err := journal.CopyFile(df.storedFile(), df.OriginalLocation); err != nil {
+			return FailErrorFrom(err)
+		}
+	} else if df.MustBeHardlinked() {
+		if err := journal.Link(df.storedFile(), df.OriginalLocation); err != nil {
+			return hardlinkError(err)
+		}
+	} else if df.IsSymlinkEntry() {
+		target, err := df.RecordedTarget()
+		if err != nil {
+			return FailErrorFrom(err)
+		}
+		if err := journal.Symlink(target, df.OriginalLocation); err != nil {
 			return FailErrorFrom(err)
 		}
 	} else {
-		symlinkTarget := df.StoredLocation
-		if df.IsAlias() {
-			symlinkTarget = df.AliasTarget
+		if err := journal.Symlink(df.LinkTarget(), df.OriginalLocation); err != nil {
+			return FailErrorFrom(err)
 		}
-		if err := os.Symlink(symlinkTarget, df.OriginalLocation); err != nil {
+	}
+
+	return nil
+}
+
+// Adopt links stored dotfile to its original location, replacing file found
+// there if its content is identical to stored file. Files that differ are
+// left alone.
+func (df *DotFile) Adopt() error {
+	if df.IsLinked() {
+		return SkipError("is linked already")
+	}
+
+	if !df.IsStored() {
+		return FailError("can adopt only already stored files")
+	}
+
+	if fsutil.IsRegularFile(df.OriginalLocation) && !df.IsSymlinkEntry() {
+		orig, err := os.ReadFile(df.OriginalLocation)
+		if err != nil {
 			return FailErrorFrom(err)
 		}
+
+		stored, err := os.ReadFile(df.storedFile())
+		if err != nil {
+			return FailErrorFrom(err)
+		}
+
+		if !bytes.Equal(orig, stored) && (textdiff.IsBinary(orig) || textdiff.IsBinary(stored)) {
+			return SkipError("differs from stored file")
+		} else if !bytes.Equal(orig, stored) {
+			summary := textdiff.Summarize(string(stored), string(orig))
+			return SkipError(fmt.Sprintf("differs from stored file (%s)", summary))
+		}
+
+		if err := journal.Remove(df.OriginalLocation); err != nil {
+			return FailErrorFrom(err)
+		}
+	}
+
+	return df.Link()
+}
+
+// Reabsorb moves regular file that replaced symlink at original location
+// into store, overwriting stored file, and links it back.
+func (df *DotFile) Reabsorb() error {
+	if df.IsLinked() {
+		return SkipError("is linked already")
+	}
+
+	if !df.IsReplaced() {
+		return FailError("was not replaced with a regular file")
+	}
+
+	if err := journal.Rename(df.OriginalLocation, df.storedFile()); err != nil {
+		return FailErrorFrom(err)
+	}
+
+	if df.MustBeHardlinked() {
+		if err := journal.Link(df.storedFile(), df.OriginalLocation); err != nil {
+			return hardlinkError(err)
+		}
+		return nil
+	}
+
+	if err := journal.Symlink(df.LinkTarget(), df.OriginalLocation); err != nil {
+		return FailErrorFrom(err)
+	}
+
+	return nil
+}
+
+// hardlinkError turns error creating hard link into FailError, explaining
+// why linking across filesystems does not work.
+func hardlinkError(err error) error {
+	if errors.Is(err, syscall.EXDEV) {
+		return FailError("store and home directory are on different filesystems, " +
+			"hard links between them are impossible (store file as a copy instead)")
+	}
+
+	return FailErrorFrom(err)
+}
+
+// isSameFile returns true if both paths refer to the same file, following
+// symlinks.
+func isSameFile(a, b string) bool {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(aInfo, bInfo)
+}
+
+// LinkTarget returns target of symlink pointing to stored file (or file
+// alias points to) from original location, either absolute or relative one,
+// depending on style of dotfile.
+func (df *DotFile) LinkTarget() string {
+	return df.linkTarget(df.Style == StyleRelative)
+}
+
+func (df *DotFile) linkTarget(relative bool) string {
+	if !relative {
+		return df.storedFile()
+	}
+
+	target, err := filepath.Rel(filepath.Dir(df.OriginalLocation), df.storedFile())
+
+	if err != nil {
+		return df.storedFile()
+	}
+
+	return target
+}
+
+// Relink replaces symlink at original location with equivalent one, either
+// absolute or relative.
+func (df *DotFile) Relink(relative bool) error {
+	if !df.IsLinked() {
+		return SkipError("is not linked")
+	}
+
+	if df.MustBeCopied() || df.MustBeHardlinked() || df.IsSymlinkEntry() {
+		return SkipError("is not linked with symlink to store")
+	}
+
+	target := df.linkTarget(relative)
+
+	if current, err := os.Readlink(df.OriginalLocation); err == nil && current == target {
+		return SkipError("is linked this way already")
+	}
+
+	if err := journal.ReplaceSymlink(target, df.OriginalLocation); err != nil {
+		return FailErrorFrom(err)
 	}
 
 	return nil
@@ -219,36 +480,192 @@ func (df *DotFile) Restore() error {
 	}
 
 	if df.IsAlias() {
-		if err := os.Remove(df.OriginalLocation); err != nil {
+		if err := journal.Remove(df.OriginalLocation); err != nil {
 			return FailErrorFrom(err)
 		}
-		if err := fsutil.DeleteEmptyDirs(filepath.Dir(df.OriginalLocation)); err != nil {
+		if err := journal.DeleteEmptyDirs(filepath.Dir(df.OriginalLocation)); err != nil {
 			return FailErrorFrom(err)
 		}
 		return nil
 	}
 
-	if df.MustBeCopied() {
-		if err := os.Remove(df.StoredLocation); err != nil {
+	if df.MustBeCopied() || df.MustBeHardlinked() || df.IsSymlinkEntry() {
+		if err := journal.Remove(df.StoredLocation); err != nil {
 			return FailErrorFrom(err)
 		}
 	} else {
-		if err := os.Remove(df.OriginalLocation); err != nil {
+		if err := journal.Remove(df.OriginalLocation); err != nil {
 			return FailErrorFrom(err)
 		}
 
-		if err := os.Rename(df.StoredLocation, df.OriginalLocation); err != nil {
+		if dirFile := filepath.Join(df.StoredLocation, DirFile); df.Folded && fsutil.Exists(dirFile) {
+			if err := journal.Remove(dirFile); err != nil {
+				return FailErrorFrom(err)
+			}
+		}
+
+		if err := journal.Rename(df.StoredLocation, df.OriginalLocation); err != nil {
 			return FailErrorFrom(err)
 		}
 	}
 
-	if err := fsutil.DeleteEmptyDirs(filepath.Dir(df.StoredLocation)); err != nil {
+	if err := journal.DeleteEmptyDirs(filepath.Dir(df.StoredLocation)); err != nil {
 		return FailErrorFrom(err)
 	}
 
 	return nil
 }
 
+// Unlink removes link (or unmodified copy) from original location, leaving
+// stored file intact.
+func (df *DotFile) Unlink() error {
+	if !fsutil.Exists(df.OriginalLocation) {
+		return SkipError("is not linked")
+	}
+
+	if !df.IsLinked() {
+		return FailError("can unlink only properly linked files")
+	}
+
+	if err := journal.Remove(df.OriginalLocation); err != nil {
+		return FailErrorFrom(err)
+	}
+
+	if err := journal.DeleteEmptyDirs(filepath.Dir(df.OriginalLocation)); err != nil {
+		return FailErrorFrom(err)
+	}
+
+	return nil
+}
+
+// Convert turns dotfile into another variant of itself (like host-specific
+// or force-copy one), renaming stored file to location of given dotfile and
+// relinking it if it was linked. Generic stored file is copied rather than
+// renamed when converting to host-specific variant, as other hosts still use
+// it. Existing stored file of target variant is overwritten only if force is
+// true. Folded directories stay folded. If linking converted dotfile fails,
+// original one is put back and linked again.
+func (df *DotFile) Convert(to *DotFile, force bool) error {
+	if df.StoredLocation == to.StoredLocation {
+		return SkipError("is of requested variant already")
+	}
+
+	if df.IsAlias() {
+		return FailError("aliases can not be converted")
+	}
+
+	if !df.IsStored() {
+		return FailError("can convert only stored files")
+	}
+
+	if df.Folded && to.MustBeCopied() {
+		return FailError("folded directories can not be copied")
+	}
+
+	if df.IsSymlinkEntry() && to.MustBeCopied() {
+		return FailError("symlinks can not be copied")
+	}
+
+	to.Folded = df.Folded
+	linked := df.IsLinked()
+
+	if !linked && fsutil.Exists(df.OriginalLocation) {
+		return FailError("can convert only properly linked files")
+	}
+
+	if fsutil.Exists(to.StoredLocation) {
+		if !force {
+			return FailError("stored file of requested variant exists already")
+		}
+
+		if err := journal.Remove(to.StoredLocation); err != nil {
+			return FailErrorFrom(err)
+		}
+	}
+
+	keep := df.IsGeneric() && !to.IsGeneric()
+
+	if linked {
+		if err := journal.Remove(df.OriginalLocation); err != nil {
+			return FailErrorFrom(err)
+		}
+	}
+
+	if keep {
+		if err := journal.CopyAll(df.StoredLocation, to.StoredLocation); err != nil {
+			return FailErrorFrom(err)
+		}
+	} else if err := journal.Rename(df.StoredLocation, to.StoredLocation); err != nil {
+		return FailErrorFrom(err)
+	}
+
+	if !linked {
+		return nil
+	}
+
+	if err := to.Link(); err != nil {
+		return FailErrorFrom(errors.Join(err, df.undoConvert(to, keep)))
+	}
+
+	return nil
+}
+
+// undoConvert puts stored file back in place after linking variant it got
+// converted to failed, and links it again. Stored file of that variant is
+// removed if it is a copy (kept is true), renamed back otherwise.
+func (df *DotFile) undoConvert(to *DotFile, kept bool) error {
+	var err error
+
+	if kept {
+		err = journal.RemoveAll(to.StoredLocation)
+	} else {
+		err = journal.Rename(to.StoredLocation, df.StoredLocation)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := journal.RemoveAll(df.OriginalLocation); err != nil {
+		return err
+	}
+
+	return df.Link()
+}
+
+// Promote makes host-specific dotfile the generic one, replacing stored file
+// of given generic dotfile with it. If content is not nil, it becomes content
+// of resulting generic file.
+func (df *DotFile) Promote(generic *DotFile, content []byte) error {
+	if !df.IsFromThisHost() {
+		return SkipError("is not specific to this host")
+	}
+
+	if !df.IsStored() {
+		return FailError("can promote only stored files")
+	}
+
+	linked := df.IsLinked()
+
+	if !linked && fsutil.Exists(df.OriginalLocation) {
+		return FailError("can promote only properly linked files")
+	}
+
+	if content != nil {
+		if err := journal.WriteFile(df.StoredLocation, content, 0666); err != nil {
+			return FailErrorFrom(err)
+		}
+
+		if linked && df.MustBeCopied() {
+			if err := journal.WriteFile(df.OriginalLocation, content, 0666); err != nil {
+				return FailErrorFrom(err)
+			}
+		}
+	}
+
+	return df.Convert(generic, true)
+}
+
 // Delete removes stored file and link to it from home dir, fails if file is
 // not linked properly.
 func (df *DotFile) Delete() error {
@@ -260,19 +677,25 @@ func (df *DotFile) Delete() error {
 		return FailError("can delete only properly linked files")
 	}
 
-	if err := os.Remove(df.StoredLocation); err != nil {
+	remove := journal.Remove
+
+	if df.Folded {
+		remove = journal.RemoveAll
+	}
+
+	if err := remove(df.StoredLocation); err != nil {
 		return FailErrorFrom(err)
 	}
 
-	if err := os.Remove(df.OriginalLocation); err != nil {
+	if err := journal.Remove(df.OriginalLocation); err != nil {
 		return FailErrorFrom(err)
 	}
 
-	if err := fsutil.DeleteEmptyDirs(filepath.Dir(df.StoredLocation)); err != nil {
+	if err := journal.DeleteEmptyDirs(filepath.Dir(df.StoredLocation)); err != nil {
 		return FailErrorFrom(err)
 	}
 
-	if err := fsutil.DeleteEmptyDirs(filepath.Dir(df.OriginalLocation)); err != nil {
+	if err := journal.DeleteEmptyDirs(filepath.Dir(df.OriginalLocation)); err != nil {
 		return FailErrorFrom(err)
 	}
 
@@ -282,21 +705,167 @@ func (df *DotFile) Delete() error {
 // IsFromThisHost returns true if dotfile is specific to current host, false
 // otherwise.
 func (df *DotFile) IsFromThisHost() bool {
-	return strings.Contains(df.StoredLocation, host.DotFileLocalSuffix())
+	v, err := variant.Parse(df.StoredLocation)
+	return err == nil && v.Host() == host.Name()
 }
 
 // IsGeneric returns true if dotfile is not specific to any host, false
 // otherwise.
 func (df *DotFile) IsGeneric() bool {
-	return !host.PathRegexp.MatchString(df.StoredLocation)
+	v, err := variant.Parse(df.StoredLocation)
+	return err == nil && v.IsGeneric()
 }
 
 // MustBeCopied returns true if dotfile can not be symlinked and must be
-// copied to appropriate place instead.
+// copied to appropriate place instead, which is also the case for aliases of
+// such dotfiles.
 func (df *DotFile) MustBeCopied() bool {
-	return regexp.MustCompile(`\.force-copy(\.|\z)`).MatchString(df.StoredLocation)
+	return df.linkStyle() == StyleCopy
+}
+
+// MustBeHardlinked returns true if dotfile must be hard linked instead of
+// symlinked.
+func (df *DotFile) MustBeHardlinked() bool {
+	return df.linkStyle() == StyleHardlink
+}
+
+// linkStyle returns way dotfile gets linked: style implied by suffixes of
+// stored file (or file alias points to) takes precedence over declared one,
+// folded directories and symlink entries are always symlinked.
+func (df *DotFile) linkStyle() string {
+	for _, path := range []string{df.StoredLocation, df.AliasTarget} {
+		if v, err := variant.Parse(path); err == nil && v.IsCopy() {
+			return StyleCopy
+		} else if err == nil && v.IsHardlink() {
+			return StyleHardlink
+		}
+	}
+
+	if df.Folded || df.IsSymlinkEntry() {
+		return StyleSymlink
+	}
+
+	if df.Style == StyleCopy || df.Style == StyleHardlink {
+		return df.Style
+	}
+
+	return StyleSymlink
+}
+
+// IsSymlinkEntry returns true if stored file (or file alias points to)
+// records target of symlink that is to be created at original location.
+func (df *DotFile) IsSymlinkEntry() bool {
+	for _, path := range []string{df.StoredLocation, df.AliasTarget} {
+		if v, err := variant.Parse(path); err == nil && v.IsSymlink() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RecordedTarget returns target of symlink recorded in stored file of
+// symlink entry, which must be a single non-empty line.
+func (df *DotFile) RecordedTarget() (string, error) {
+	content, err := os.ReadFile(df.storedFile())
+
+	if err != nil {
+		return "", err
+	}
+
+	target := strings.TrimSuffix(string(content), "\n")
+
+	if target == "" || strings.ContainsAny(target, "\n\x00") {
+		return "", fmt.Errorf("%s does not record symlink target as a single non-empty line", df.storedFile())
+	}
+
+	return target, nil
 }
 
 func (df *DotFile) IsAlias() bool {
 	return df.AliasTarget != ""
 }
+
+// IsLinkedInOtherStyle returns true if file at original location is what
+// linking dotfile in other style (like symlinking instead of copying)
+// produces, which is the case after its style changes.
+func (df *DotFile) IsLinkedInOtherStyle() bool {
+	if !df.IsStored() || df.Folded || df.IsSymlinkEntry() {
+		return false
+	}
+
+	if target, err := fsutil.ResolveSymlink(df.OriginalLocation); err == nil {
+		return target == df.storedFile() && (df.MustBeCopied() || df.MustBeHardlinked())
+	}
+
+	if !fsutil.IsRegularFile(df.OriginalLocation) {
+		return false
+	}
+
+	if isSameFile(df.OriginalLocation, df.storedFile()) {
+		return !df.MustBeHardlinked()
+	}
+
+	same, err := fsutil.SameContent(df.OriginalLocation, df.storedFile())
+
+	return err == nil && same && !df.MustBeCopied()
+}
+
+// ModeDrift describes how mode of stored file (and of copy at original
+// location) differs from declared one.
+func (df *DotFile) ModeDrift() []string {
+	var drift []string
+
+	for _, path := range df.modeManagedFiles() {
+		if fi, err := os.Stat(path); err == nil && fi.Mode().Perm() != df.Mode {
+			drift = append(drift, fmt.Sprintf("mode %04o, expected %04o", fi.Mode().Perm(), df.Mode))
+		}
+	}
+
+	return drift
+}
+
+// FixMode changes mode of stored file (and of copy at original location) to
+// declared one.
+func (df *DotFile) FixMode() error {
+	for _, path := range df.modeManagedFiles() {
+		if fi, err := os.Stat(path); err != nil {
+			return FailErrorFrom(err)
+		} else if fi.Mode().Perm() == df.Mode {
+			continue
+		}
+
+		if err := journal.Chmod(path, df.Mode); err != nil {
+			return FailErrorFrom(err)
+		}
+	}
+
+	return nil
+}
+
+// modeManagedFiles returns locations of files mode of which is declared.
+func (df *DotFile) modeManagedFiles() []string {
+	var paths []string
+
+	if df.Mode == 0 || df.IsSymlinkEntry() || !df.IsStored() {
+		return paths
+	}
+
+	paths = append(paths, df.storedFile())
+
+	if df.MustBeCopied() && fsutil.IsRegularFile(df.OriginalLocation) {
+		paths = append(paths, df.OriginalLocation)
+	}
+
+	return paths
+}
+
+// storedFile returns location of regular file in store holding content of
+// dotfile, which is alias target for aliases.
+func (df *DotFile) storedFile() string {
+	if df.IsAlias() {
+		return df.AliasTarget
+	}
+
+	return df.StoredLocation
+}
@@ -1,9 +1,11 @@
 package dotfile_test
 
 import (
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	. "github.com/vderyagin/dfm/dotfile"
 	. "github.com/vderyagin/dfm/fsutil"
@@ -36,6 +38,12 @@ var _ = Describe("Dotfile", func() {
 		return New(stored(), orig())
 	}
 
+	stat := func(path string) os.FileInfo {
+		fi, err := os.Stat(path)
+		Expect(err).To(Succeed())
+		return fi
+	}
+
 	Describe("IsStored", func() {
 		It("returns true if file is properly stored", func() {
 			CreateFile(stored())
@@ -289,6 +297,101 @@ var _ = Describe("Dotfile", func() {
 		})
 	})
 
+	Describe("Adopt", func() {
+		It("replaces identical file at original location with symlink", func() {
+			CreateFileWithContent(stored(), []byte("foo"))
+			CreateFileWithContent(orig(), []byte("foo"))
+
+			Expect(df().Adopt()).To(Succeed())
+			Expect(df().IsLinked()).To(BeTrue())
+		})
+
+		It("links file if there's nothing at original location", func() {
+			CreateFile(stored())
+
+			Expect(df().Adopt()).To(Succeed())
+			Expect(df().IsLinked()).To(BeTrue())
+		})
+
+		It("leaves different file alone, returning SkipError", func() {
+			CreateFileWithContent(stored(), []byte("foo\n"))
+			CreateFileWithContent(orig(), []byte("bar\nbaz\n"))
+
+			err := df().Adopt()
+			Expect(err).To(BeAssignableToTypeOf(SkipError("")))
+			Expect(err.Error()).To(ContainSubstring("+2 -1"))
+			Expect(IsRegularFile(orig())).To(BeTrue())
+		})
+
+		It("fails if file is not stored", func() {
+			CreateFile(orig())
+
+			Expect(df().Adopt()).NotTo(Succeed())
+		})
+	})
+
+	Describe("IsReplaced", func() {
+		ago := time.Now().Add(-time.Hour)
+
+		It("returns true if symlink was replaced by newer file with different content", func() {
+			CreateFileWithContent(stored(), []byte("foo"))
+			os.Chtimes(stored(), ago, ago)
+			CreateFileWithContent(orig(), []byte("bar"))
+
+			Expect(df().IsReplaced()).To(BeTrue())
+		})
+
+		It("returns false if file at original location has the same content", func() {
+			CreateFileWithContent(stored(), []byte("foo"))
+			os.Chtimes(stored(), ago, ago)
+			CreateFileWithContent(orig(), []byte("foo"))
+
+			Expect(df().IsReplaced()).To(BeFalse())
+		})
+
+		It("returns false if stored file is newer", func() {
+			CreateFileWithContent(orig(), []byte("bar"))
+			os.Chtimes(orig(), ago, ago)
+			CreateFileWithContent(stored(), []byte("foo"))
+
+			Expect(df().IsReplaced()).To(BeFalse())
+		})
+
+		It("returns false if file is linked", func() {
+			CreateFile(stored())
+			df().Link()
+
+			Expect(df().IsReplaced()).To(BeFalse())
+		})
+	})
+
+	Describe("Reabsorb", func() {
+		It("moves file into store and links it back", func() {
+			CreateFileWithContent(stored(), []byte("foo"))
+			os.Chtimes(stored(), time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+			CreateFileWithContent(orig(), []byte("bar"))
+
+			Expect(df().Reabsorb()).To(Succeed())
+			Expect(df().IsLinked()).To(BeTrue())
+
+			content, _ := ioutil.ReadFile(stored())
+			Expect(string(content)).To(Equal("bar"))
+		})
+
+		It("returns SkipError if file is linked already", func() {
+			CreateFile(stored())
+			df().Link()
+
+			Expect(df().Reabsorb()).To(BeAssignableToTypeOf(SkipError("")))
+		})
+
+		It("fails if file was not replaced", func() {
+			CreateFile(stored())
+
+			Expect(df().Reabsorb()).NotTo(Succeed())
+		})
+	})
+
 	Describe("Restore", func() {
 		It("returns SkipError if file was not stored at all", func() {
 			CreateFile(orig())
@@ -328,6 +431,201 @@ var _ = Describe("Dotfile", func() {
 		})
 	})
 
+	Describe("Unlink", func() {
+		It("removes symlink, keeping stored file", func() {
+			CreateFile(stored())
+			df().Link()
+
+			Expect(df().Unlink()).To(Succeed())
+			Expect(Exists(orig())).To(BeFalse())
+			Expect(IsRegularFile(stored())).To(BeTrue())
+		})
+
+		It("removes empty nested directories in home only", func() {
+			stored, _ := filepath.Abs("config/camlistore/server-config.json")
+			orig, _ := filepath.Abs(".config/camlistore/server-config.json")
+			df := New(stored, orig)
+			CreateFile(stored)
+			df.Link()
+
+			Expect(df.Unlink()).To(Succeed())
+			Expect(Exists(".config")).To(BeFalse())
+			Expect(IsRegularFile(stored)).To(BeTrue())
+		})
+
+		It("returns SkipError if there's nothing at original location", func() {
+			CreateFile(stored())
+
+			Expect(df().Unlink()).To(BeAssignableToTypeOf(SkipError("")))
+		})
+
+		It("fails if file at original location is not a link to stored file", func() {
+			CreateFile(stored())
+			CreateFile(orig())
+
+			Expect(df().Unlink()).NotTo(Succeed())
+			Expect(Exists(orig())).To(BeTrue())
+		})
+
+		Context("force-copy files", func() {
+			stored := func() string {
+				s, _ := filepath.Abs("foo.force-copy")
+				return s
+			}
+
+			df := func() *DotFile {
+				return New(stored(), orig())
+			}
+
+			It("removes unmodified copy", func() {
+				CreateFileWithContent(stored(), []byte("foo"))
+				CreateFileWithContent(orig(), []byte("foo"))
+
+				Expect(df().Unlink()).To(Succeed())
+				Expect(Exists(orig())).To(BeFalse())
+				Expect(IsRegularFile(stored())).To(BeTrue())
+			})
+
+			It("does not remove modified copy", func() {
+				CreateFileWithContent(stored(), []byte("foo"))
+				CreateFileWithContent(orig(), []byte("bar"))
+
+				Expect(df().Unlink()).NotTo(Succeed())
+				Expect(Exists(orig())).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("Convert", func() {
+		to := func() *DotFile {
+			s, _ := filepath.Abs("foo.force-copy")
+			return New(s, orig())
+		}
+
+		It("renames stored file and relinks it", func() {
+			CreateFileWithContent(stored(), []byte("foo"))
+			df().Link()
+
+			Expect(df().Convert(to(), false)).To(Succeed())
+			Expect(Exists(stored())).To(BeFalse())
+			Expect(to().IsLinked()).To(BeTrue())
+			Expect(IsRegularFile(orig())).To(BeTrue())
+		})
+
+		It("does not link files that were not linked", func() {
+			CreateFile(stored())
+
+			Expect(df().Convert(to(), false)).To(Succeed())
+			Expect(IsRegularFile(to().StoredLocation)).To(BeTrue())
+			Expect(Exists(orig())).To(BeFalse())
+		})
+
+		It("returns SkipError if dotfile is of requested variant already", func() {
+			CreateFile(stored())
+
+			Expect(df().Convert(df(), false)).To(BeAssignableToTypeOf(SkipError("")))
+		})
+
+		It("fails if there's a conflicting file at original location", func() {
+			CreateFile(stored())
+			CreateFile(orig())
+
+			Expect(df().Convert(to(), false)).NotTo(Succeed())
+			Expect(Exists(stored())).To(BeTrue())
+		})
+
+		It("fails if stored file of requested variant exists", func() {
+			CreateFile(stored())
+			CreateFile(to().StoredLocation)
+
+			Expect(df().Convert(to(), false)).NotTo(Succeed())
+			Expect(Exists(stored())).To(BeTrue())
+		})
+
+		It("overwrites stored file of requested variant if forced", func() {
+			CreateFileWithContent(stored(), []byte("foo"))
+			CreateFileWithContent(to().StoredLocation, []byte("bar"))
+
+			Expect(df().Convert(to(), true)).To(Succeed())
+			Expect(Exists(stored())).To(BeFalse())
+			Expect(ioutil.ReadFile(to().StoredLocation)).To(Equal([]byte("foo")))
+		})
+
+		It("links original file again if linking converted one fails", func() {
+			CreateFileWithContent(stored(), []byte("foo"))
+			df().Link()
+			CreateFile("file")
+			file, _ := filepath.Abs("file")
+
+			err := df().Convert(New(to().StoredLocation, filepath.Join(file, "foo")), false)
+
+			Expect(err).To(BeAssignableToTypeOf(FailError("")))
+			Expect(Exists(to().StoredLocation)).To(BeFalse())
+			Expect(df().IsLinked()).To(BeTrue())
+		})
+
+		Context("to host-specific variant", func() {
+			ExecuteEachWithHostName("myhost")
+
+			hostSpecific := func() *DotFile {
+				s, _ := filepath.Abs("foo.host-myhost")
+				return New(s, orig())
+			}
+
+			It("keeps generic stored file for other hosts", func() {
+				CreateFileWithContent(stored(), []byte("foo"))
+				df().Link()
+
+				Expect(df().Convert(hostSpecific(), false)).To(Succeed())
+				Expect(ioutil.ReadFile(stored())).To(Equal([]byte("foo")))
+				Expect(ioutil.ReadFile(hostSpecific().StoredLocation)).To(Equal([]byte("foo")))
+				Expect(hostSpecific().IsLinked()).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("Promote", func() {
+		ExecuteEachWithHostName("myhost")
+
+		hostSpecific := func() *DotFile {
+			s, _ := filepath.Abs("foo.host-myhost")
+			return New(s, orig())
+		}
+
+		It("replaces generic file with host-specific one", func() {
+			CreateFileWithContent(stored(), []byte("generic"))
+			CreateFileWithContent(hostSpecific().StoredLocation, []byte("specific"))
+			hostSpecific().Link()
+
+			Expect(hostSpecific().Promote(df(), nil)).To(Succeed())
+			Expect(Exists(hostSpecific().StoredLocation)).To(BeFalse())
+			Expect(ioutil.ReadFile(stored())).To(Equal([]byte("specific")))
+			Expect(df().IsLinked()).To(BeTrue())
+		})
+
+		It("uses given content for generic file", func() {
+			CreateFileWithContent(stored(), []byte("generic"))
+			CreateFileWithContent(hostSpecific().StoredLocation, []byte("specific"))
+
+			Expect(hostSpecific().Promote(df(), []byte("merged"))).To(Succeed())
+			Expect(ioutil.ReadFile(stored())).To(Equal([]byte("merged")))
+		})
+
+		It("returns SkipError for generic files", func() {
+			CreateFile(stored())
+
+			Expect(df().Promote(df(), nil)).To(BeAssignableToTypeOf(SkipError("")))
+		})
+
+		It("fails if there's a conflicting file at original location", func() {
+			CreateFile(hostSpecific().StoredLocation)
+			CreateFile(orig())
+
+			Expect(hostSpecific().Promote(df(), []byte("merged"))).NotTo(Succeed())
+			Expect(ioutil.ReadFile(hostSpecific().StoredLocation)).To(BeEmpty())
+		})
+	})
+
 	Describe("Delete", func() {
 		It("removes both stored file and link to it from original dotfile location", func() {
 			o, s := orig(), stored()
@@ -471,6 +769,75 @@ var _ = Describe("Dotfile", func() {
 		})
 	})
 
+	Context("folded directories", func() {
+		var storedDir, origDir string
+
+		BeforeEach(func() {
+			storedDir, _ = filepath.Abs("nvim")
+			origDir, _ = filepath.Abs(".nvim")
+		})
+
+		folded := func() *DotFile {
+			df := New(storedDir, origDir)
+			df.Folded = true
+			return df
+		}
+
+		It("stores directory as a whole, marking it as folded", func() {
+			CreateFileWithContent(".nvim/lua/init.lua", []byte("foo"))
+
+			Expect(folded().Store()).To(Succeed())
+			Expect(ioutil.ReadFile("nvim/lua/init.lua")).To(Equal([]byte("foo")))
+			Expect(ioutil.ReadFile("nvim/" + DirFile)).To(Equal([]byte(FoldDirective + "\n")))
+			Expect(IsSymlink(origDir)).To(BeTrue())
+			Expect(folded().IsLinked()).To(BeTrue())
+		})
+
+		It("links directory with a single symlink", func() {
+			CreateFile("nvim/init.lua")
+
+			Expect(folded().IsStored()).To(BeTrue())
+			Expect(folded().Link()).To(Succeed())
+			Expect(folded().IsLinked()).To(BeTrue())
+			Expect(folded().CurrentState().String()).To(Equal(Linked.String()))
+		})
+
+		It("is not linked if there's a real directory at original location", func() {
+			CreateFile("nvim/init.lua")
+			CreateDir(".nvim")
+
+			Expect(folded().IsLinked()).To(BeFalse())
+			Expect(folded().CurrentState().String()).To(Equal(Conflict.String()))
+		})
+
+		It("restores directory without marker", func() {
+			CreateFile(".nvim/init.lua")
+			folded().Store()
+
+			Expect(folded().Restore()).To(Succeed())
+			Expect(IsRegularFile(".nvim/init.lua")).To(BeTrue())
+			Expect(Exists(".nvim/" + DirFile)).To(BeFalse())
+			Expect(Exists("nvim")).To(BeFalse())
+		})
+
+		It("deletes whole directory", func() {
+			CreateFile(".nvim/lua/init.lua")
+			folded().Store()
+
+			Expect(folded().Delete()).To(Succeed())
+			Expect(Exists("nvim")).To(BeFalse())
+			Expect(Exists(".nvim")).To(BeFalse())
+		})
+
+		It("can not be copied", func() {
+			CreateFile(".nvim/init.lua")
+			storedDir, _ = filepath.Abs("nvim.force-copy")
+
+			Expect(folded().Store()).NotTo(Succeed())
+			Expect(IsDir(".nvim")).To(BeTrue())
+		})
+	})
+
 	Context("alias files", func() {
 		var targetStored, aliasStored, aliasTarget, aliasOrig string
 
@@ -591,6 +958,17 @@ var _ = Describe("Dotfile", func() {
 
 				Expect(aliasDf().Link()).NotTo(Succeed())
 			})
+
+			It("copies force-copy alias target", func() {
+				aliasTarget, _ = filepath.Abs("foo.force-copy")
+				CreateFileWithContent(aliasTarget, []byte("foo"))
+				os.Symlink("foo.force-copy", aliasStored)
+
+				Expect(aliasDf().Link()).To(Succeed())
+				Expect(IsRegularFile(aliasOrig)).To(BeTrue())
+				Expect(ioutil.ReadFile(aliasOrig)).To(Equal([]byte("foo")))
+				Expect(aliasDf().IsLinked()).To(BeTrue())
+			})
 		})
 
 		Describe("Restore", func() {
@@ -651,4 +1029,256 @@ var _ = Describe("Dotfile", func() {
 			})
 		})
 	})
+
+	Context("symlink entries", func() {
+		stored := func() string {
+			s, _ := filepath.Abs("foo.dfm-symlink")
+			return s
+		}
+
+		df := func() *DotFile {
+			return New(stored(), orig())
+		}
+
+		It("records symlink target in store, leaving symlink in place", func() {
+			os.Symlink("/some/target", orig())
+
+			Expect(df().IsReadyToBeStored()).To(BeTrue())
+			Expect(df().Store()).To(Succeed())
+			Expect(ioutil.ReadFile(stored())).To(Equal([]byte("/some/target\n")))
+			Expect(os.Readlink(orig())).To(Equal("/some/target"))
+			Expect(df().IsLinked()).To(BeTrue())
+		})
+
+		It("is not ready to be stored if original is a regular file", func() {
+			CreateFile(orig())
+
+			Expect(df().IsReadyToBeStored()).To(BeFalse())
+		})
+
+		It("recreates symlink with recorded target when linked", func() {
+			ioutil.WriteFile(stored(), []byte("../target\n"), 0644)
+
+			Expect(df().Link()).To(Succeed())
+			Expect(os.Readlink(orig())).To(Equal("../target"))
+		})
+
+		It("refuses to link records that are not a single non-empty line", func() {
+			for _, content := range []string{"", "\n", "/some/target\n/other/target\n"} {
+				ioutil.WriteFile(stored(), []byte(content), 0644)
+
+				Expect(df().Link()).NotTo(Succeed())
+				Expect(Exists(orig())).To(BeFalse())
+			}
+		})
+
+		It("is not linked if symlink points elsewhere", func() {
+			ioutil.WriteFile(stored(), []byte("/some/target\n"), 0644)
+			os.Symlink("/other/target", orig())
+
+			Expect(df().IsLinked()).To(BeFalse())
+			Expect(df().CurrentState()).To(Equal(&Conflict))
+		})
+
+		It("removes record from store when restored, keeping symlink", func() {
+			os.Symlink("/some/target", orig())
+			df().Store()
+
+			Expect(df().Restore()).To(Succeed())
+			Expect(Exists(stored())).To(BeFalse())
+			Expect(os.Readlink(orig())).To(Equal("/some/target"))
+		})
+
+		It("can not be converted to copy", func() {
+			os.Symlink("/some/target", orig())
+			df().Store()
+
+			copied, _ := filepath.Abs("foo.force-copy")
+			Expect(df().Convert(New(copied, orig()), false)).NotTo(Succeed())
+		})
+	})
+
+	Context("declared link style", func() {
+		copied := func() *DotFile {
+			d := df()
+			d.Style = StyleCopy
+			return d
+		}
+
+		It("copies file declared to be copied", func() {
+			CreateFile(stored())
+
+			Expect(copied().Link()).To(Succeed())
+			Expect(IsRegularFile(orig())).To(BeTrue())
+			Expect(copied().IsLinked()).To(BeTrue())
+		})
+
+		It("recognizes files linked in other style", func() {
+			CreateFile(stored())
+			df().Link()
+
+			Expect(df().IsLinkedInOtherStyle()).To(BeFalse())
+			Expect(copied().IsLinkedInOtherStyle()).To(BeTrue())
+
+			os.Remove(orig())
+			copied().Link()
+
+			Expect(copied().IsLinkedInOtherStyle()).To(BeFalse())
+			Expect(df().IsLinkedInOtherStyle()).To(BeTrue())
+		})
+	})
+
+	Context("declared mode", func() {
+		withMode := func() *DotFile {
+			d := df()
+			d.Mode = 0600
+			return d
+		}
+
+		It("reports and fixes mode of stored file", func() {
+			CreateFile(stored())
+			os.Chmod(stored(), 0644)
+
+			Expect(withMode().ModeDrift()).To(Equal([]string{"mode 0644, expected 0600"}))
+			Expect(withMode().FixMode()).To(Succeed())
+			Expect(withMode().ModeDrift()).To(BeEmpty())
+
+			fi, _ := os.Stat(stored())
+			Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+
+		It("does not report anything if mode is not declared", func() {
+			CreateFile(stored())
+			os.Chmod(stored(), 0644)
+
+			Expect(df().ModeDrift()).To(BeEmpty())
+		})
+	})
+
+	Context("relative symlinks", func() {
+		relative := func() *DotFile {
+			s, _ := filepath.Abs("store/foo")
+			o, _ := filepath.Abs("home/.foo")
+			d := New(s, o)
+			d.Style = StyleRelative
+			return d
+		}
+
+		absolute := func() *DotFile {
+			d := relative()
+			d.Style = ""
+			return d
+		}
+
+		BeforeEach(func() {
+			CreateFile("store/foo")
+			CreateDir("home")
+		})
+
+		It("links file with relative symlink", func() {
+			Expect(relative().Link()).To(Succeed())
+			Expect(os.Readlink("home/.foo")).To(Equal("../store/foo"))
+		})
+
+		It("considers file linked with symlink of either style", func() {
+			relative().Link()
+			Expect(absolute().IsLinked()).To(BeTrue())
+
+			os.Remove("home/.foo")
+			absolute().Link()
+			Expect(relative().IsLinked()).To(BeTrue())
+		})
+
+		It("converts absolute symlink to relative one", func() {
+			absolute().Link()
+
+			Expect(absolute().Relink(true)).To(Succeed())
+			Expect(os.Readlink("home/.foo")).To(Equal("../store/foo"))
+			Expect(absolute().Relink(true)).To(BeAssignableToTypeOf(SkipError("")))
+		})
+
+		It("converts relative symlink to absolute one", func() {
+			relative().Link()
+
+			Expect(relative().Relink(false)).To(Succeed())
+			Expect(os.Readlink("home/.foo")).To(Equal(relative().StoredLocation))
+		})
+
+		It("does not relink files that are not linked", func() {
+			Expect(relative().Relink(true)).To(BeAssignableToTypeOf(SkipError("")))
+		})
+	})
+
+	Context("hard linked files", func() {
+		stored := func() string {
+			s, _ := filepath.Abs("foo.hardlink")
+			return s
+		}
+
+		df := func() *DotFile {
+			return New(stored(), orig())
+		}
+
+		It("stores file by hard linking it into store", func() {
+			CreateFile(orig())
+
+			Expect(df().Store()).To(Succeed())
+			Expect(IsRegularFile(orig())).To(BeTrue())
+			Expect(os.SameFile(stat(orig()), stat(stored()))).To(BeTrue())
+			Expect(df().IsLinked()).To(BeTrue())
+		})
+
+		It("links file with hard link", func() {
+			CreateFile(stored())
+
+			Expect(df().Link()).To(Succeed())
+			Expect(os.SameFile(stat(orig()), stat(stored()))).To(BeTrue())
+		})
+
+		It("is not relinked with symlink", func() {
+			CreateFile(stored())
+			df().Link()
+
+			for _, relative := range []bool{true, false} {
+				Expect(df().Relink(relative)).To(BeAssignableToTypeOf(SkipError("")))
+				Expect(IsRegularFile(orig())).To(BeTrue())
+				Expect(os.SameFile(stat(orig()), stat(stored()))).To(BeTrue())
+			}
+		})
+
+		It("is not linked with a copy or symlink", func() {
+			CreateFileWithContent(stored(), []byte("foo"))
+			CreateFileWithContent(orig(), []byte("foo"))
+
+			Expect(df().IsLinked()).To(BeFalse())
+			Expect(df().IsLinkedInOtherStyle()).To(BeTrue())
+
+			os.Remove(orig())
+			os.Symlink(stored(), orig())
+
+			Expect(df().IsLinked()).To(BeFalse())
+			Expect(df().IsLinkedInOtherStyle()).To(BeTrue())
+		})
+
+		It("removes file from store when restored", func() {
+			CreateFile(orig())
+			df().Store()
+
+			Expect(df().Restore()).To(Succeed())
+			Expect(Exists(stored())).To(BeFalse())
+			Expect(IsRegularFile(orig())).To(BeTrue())
+		})
+
+		It("links reabsorbed file back with hard link", func() {
+			CreateFileWithContent(stored(), []byte("old"))
+			df().Link()
+			os.Remove(orig())
+			time.Sleep(10 * time.Millisecond)
+			CreateFileWithContent(orig(), []byte("new"))
+
+			Expect(df().Reabsorb()).To(Succeed())
+			Expect(os.SameFile(stat(orig()), stat(stored()))).To(BeTrue())
+			Expect(ioutil.ReadFile(stored())).To(Equal([]byte("new")))
+		})
+	})
 })
@@ -12,6 +12,7 @@ var (
 	Linked    = State("linked")
 	NotLinked = State("not linked")
 	Conflict  = State("conflict")
+	Replaced  = State("replaced")
 	Missing   = State("missing")
 )
 
@@ -32,6 +33,8 @@ func (df *DotFile) CurrentState() *State {
 		return &Missing
 	} else if _, err := os.Lstat(df.OriginalLocation); os.IsNotExist(err) {
 		return &NotLinked
+	} else if df.IsReplaced() {
+		return &Replaced
 	}
 
 	return &Conflict
@@ -48,6 +51,8 @@ func (s *State) ColorString() string {
 		formatStr = ansi.Color(" %s ", "yellow+b")
 	case Conflict:
 		formatStr = ansi.Color(" %s ", "red+b")
+	case Replaced:
+		formatStr = ansi.Color(" %s ", "magenta+b")
 	case Missing:
 		formatStr = ansi.Color(" %s ", "red+bi")
 	}
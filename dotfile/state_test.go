@@ -2,7 +2,9 @@ package dotfile_test
 
 import (
 	"log"
+	"os"
 	"path/filepath"
+	"time"
 
 	. "github.com/vderyagin/dfm/dotfile"
 	. "github.com/vderyagin/dfm/testutil"
@@ -54,6 +56,14 @@ var _ = Describe("CurrentState", func() {
 		Expect(df().CurrentState().String()).To(Equal(Conflict.String()))
 	})
 
+	It("correctly assigns 'Replaced' state", func() {
+		CreateFileWithContent(stored(), []byte("foo"))
+		os.Chtimes(stored(), time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+		CreateFileWithContent(orig(), []byte("bar"))
+
+		Expect(df().CurrentState().String()).To(Equal(Replaced.String()))
+	})
+
 	It("correctly assigns 'Missing' state", func() {
 		Expect(df().CurrentState().String()).To(Equal(Missing.String()))
 	})
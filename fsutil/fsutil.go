@@ -1,6 +1,7 @@
 package fsutil
 
 import (
+	"bytes"
 	"crypto/md5"
 	"io"
 	"log"
@@ -88,6 +89,35 @@ func IsRegularFile(path string) bool {
 	return fi.Mode().IsRegular()
 }
 
+// IsDir determines whether given path corresponds to a directory (not a
+// symlink to one).
+func IsDir(path string) bool {
+	fi, err := os.Lstat(path)
+
+	if err != nil {
+		return false
+	}
+
+	return fi.IsDir()
+}
+
+// CanCreate determines whether file can be created at given path: nothing
+// exists there and the closest existing directory above it is indeed a
+// directory (or a symlink to one), not a file.
+func CanCreate(path string) bool {
+	if Exists(path) {
+		return false
+	}
+
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if fi, err := os.Stat(dir); err == nil {
+			return fi.IsDir()
+		} else if !os.IsNotExist(err) || dir == filepath.Dir(dir) {
+			return false
+		}
+	}
+}
+
 // IsSymlink determines whether given path corresponds to a symbolic link.
 func IsSymlink(path string) bool {
 	if fi, err := os.Lstat(path); err != nil {
@@ -99,6 +129,12 @@ func IsSymlink(path string) bool {
 	return false
 }
 
+// IsUnder determines whether given path is the same as dir or located
+// somewhere within it.
+func IsUnder(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
 // MD5 calculates MD5 hash of provided file.
 func MD5(path string) ([]byte, error) {
 	var result []byte
@@ -119,6 +155,23 @@ func MD5(path string) ([]byte, error) {
 	return hash.Sum(result), nil
 }
 
+// SameContent determines whether two files have identical content.
+func SameContent(a, b string) (bool, error) {
+	aMD5, err := MD5(a)
+
+	if err != nil {
+		return false, err
+	}
+
+	bMD5, err := MD5(b)
+
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(aMD5, bMD5), nil
+}
+
 // CopyFile copies file src to dst.
 func CopyFile(src, dst string) error {
 	s, err := os.Open(src)
@@ -137,6 +137,24 @@ var _ = Describe("FSutil", func() {
 		})
 	})
 
+	Describe("IsDir", func() {
+		It("returns true for directories", func() {
+			CreateDir("foo")
+			Expect(IsDir("foo")).To(BeTrue())
+		})
+
+		It("returns false for regular files", func() {
+			CreateFile("foo")
+			Expect(IsDir("foo")).To(BeFalse())
+		})
+
+		It("returns false for symlinks to directories", func() {
+			CreateDir("foo")
+			os.Symlink("foo", "bar")
+			Expect(IsDir("bar")).To(BeFalse())
+		})
+	})
+
 	Describe("IsSymlink", func() {
 		It("returns true for symlink", func() {
 			CreateFile("foo")
@@ -166,6 +184,25 @@ var _ = Describe("FSutil", func() {
 		})
 	})
 
+	Describe("IsUnder", func() {
+		It("returns true for the same path", func() {
+			Expect(IsUnder("/foo/bar", "/foo/bar")).To(BeTrue())
+		})
+
+		It("returns true for paths within directory", func() {
+			Expect(IsUnder("/foo/bar/baz", "/foo")).To(BeTrue())
+			Expect(IsUnder("/foo/bar/baz", "/foo/")).To(BeTrue())
+		})
+
+		It("returns false for paths sharing prefix with directory", func() {
+			Expect(IsUnder("/foo/barbaz", "/foo/bar")).To(BeFalse())
+		})
+
+		It("returns false for paths outside directory", func() {
+			Expect(IsUnder("/foo", "/foo/bar")).To(BeFalse())
+		})
+	})
+
 	Describe("SymlinksIn", func() {
 		It("returns empty closed channel if argument does not exist", func() {
 			Expect(chanToSlice(SymlinksIn("nonexistent_dir"))).To(BeEmpty())
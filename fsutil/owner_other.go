@@ -0,0 +1,11 @@
+//go:build !unix
+
+package fsutil
+
+import "fmt"
+
+// Owner returns ids of user and group owning file at given path. Ownership
+// information is not available on this platform.
+func Owner(path string) (uid, gid int, err error) {
+	return 0, 0, fmt.Errorf("%s: ownership information is not available", path)
+}
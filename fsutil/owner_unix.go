@@ -0,0 +1,27 @@
+//go:build unix
+
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Owner returns ids of user and group owning file at given path, following
+// symlinks.
+func Owner(path string) (uid, gid int, err error) {
+	fi, err := os.Stat(path)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+
+	if !ok {
+		return 0, 0, fmt.Errorf("%s: ownership information is not available", path)
+	}
+
+	return int(st.Uid), int(st.Gid), nil
+}
@@ -3,7 +3,8 @@ package host
 import (
 	"log"
 	"os"
-	"regexp"
+
+	"github.com/vderyagin/dfm/variant"
 )
 
 // Name returns a hostname of a host machine. Can be overridden by setting
@@ -24,14 +25,5 @@ func Name() string {
 
 // DotFileLocalSuffix returns a suffix to be added to host-specific dotfiles' paths.
 func DotFileLocalSuffix() string {
-	return ".host-" + Name()
-}
-
-// RemoveSuffix returns string without host-specific suffix, returns original
-// string if it has no such suffix.
-func RemoveSuffix(input string) string {
-	return PathRegexp.ReplaceAllLiteralString(input, "")
+	return variant.HostSuffix(Name())
 }
-
-// PathRegexp returns regexp matching path of any host-specific dotfile.
-var PathRegexp = regexp.MustCompile(`\.host-[[:alnum:]]+`)
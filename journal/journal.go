@@ -0,0 +1,279 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/vderyagin/dfm/fsutil"
+	"github.com/vderyagin/dfm/host"
+)
+
+// Operations recorded in journal.
+const (
+	OpSymlink  = "symlink"
+	OpHardlink = "hardlink"
+	OpRename   = "rename"
+	OpCopy     = "copy"
+	OpWrite    = "write"
+	OpRemove   = "remove"
+	OpMkdir    = "mkdir"
+	OpRmdir    = "rmdir"
+	OpChmod    = "chmod"
+	OpChown    = "chown"
+
+	// OpUndo marks end of attempt to undo run given by Undoes field, with
+	// Previous field holding number of its changes reverted so far.
+	OpUndo = "undo"
+)
+
+// Entry represents a single filesystem change. Path is the path that got
+// changed, Source is the other path involved in operation (symlink target,
+// renamed or copied file), Before and After are fingerprints of Path before
+// and after the change. Backup points to a copy of regular file that got
+// removed or overwritten by the change, Previous holds mode or owner of Path
+// changed by the change, Undoes is set for changes made while undoing some
+// other run.
+type Entry struct {
+	Run      string    `json:"run"`
+	Time     time.Time `json:"time"`
+	Command  []string  `json:"command"`
+	Host     string    `json:"host"`
+	Op       string    `json:"op"`
+	Path     string    `json:"path"`
+	Source   string    `json:"source,omitempty"`
+	Before   string    `json:"before,omitempty"`
+	After    string    `json:"after,omitempty"`
+	Backup   string    `json:"backup,omitempty"`
+	Previous string    `json:"previous,omitempty"`
+	Undoes   string    `json:"undoes,omitempty"`
+}
+
+// Journal is an append-only log of filesystem changes stored in a given
+// directory. All changes made during single invocation of dfm share the same
+// run identifier.
+type Journal struct {
+	Dir     string
+	Run     string
+	Command []string
+	Undoes  string
+	backups int
+	err     error
+}
+
+var current *Journal
+
+// Start makes all subsequent filesystem changes performed through this
+// package get recorded in journal located in given directory. Directory is
+// not created until there is something to record.
+func Start(dir string, command []string) error {
+	absDir, err := filepath.Abs(dir)
+
+	if err != nil {
+		return err
+	}
+
+	current = &Journal{
+		Dir:     absDir,
+		Run:     time.Now().UTC().Format("20060102T150405.000000000Z"),
+		Command: command,
+	}
+
+	return nil
+}
+
+// Stop disables recording of filesystem changes.
+func Stop() {
+	current = nil
+}
+
+// Err returns first error recording of changes ran into, nil if there were
+// none. Changes are made regardless of such errors, so that operations are
+// not left half-done, and get reported when command is finished instead.
+func Err() error {
+	if current == nil {
+		return nil
+	}
+
+	return current.err
+}
+
+// Current returns journal changes are currently recorded in, nil if
+// recording is disabled.
+func Current() *Journal {
+	return current
+}
+
+// Path returns location of journal file.
+func (j *Journal) Path() string {
+	return filepath.Join(j.Dir, "journal.jsonl")
+}
+
+// Entries returns all entries recorded in journal, oldest first. Missing
+// journal file is treated as empty one.
+func (j *Journal) Entries() ([]Entry, error) {
+	var entries []Entry
+
+	file, err := os.Open(j.Path())
+
+	if os.IsNotExist(err) {
+		return entries, nil
+	} else if err != nil {
+		return entries, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var e Entry
+
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return entries, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, scanner.Err()
+}
+
+func (j *Journal) append(e Entry) error {
+	if err := os.MkdirAll(j.Dir, 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(j.Path(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(e)
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// BackupsDir returns location of directory copies of removed and
+// overwritten files are kept in.
+func (j *Journal) BackupsDir() string {
+	return filepath.Join(j.Dir, "backups")
+}
+
+// backup saves a copy of regular file at given path, so that it can be
+// brought back when undoing. Copy gets mode of the file. Returns location of
+// the copy, empty string if there is nothing to back up.
+func backup(path string) (string, error) {
+	if current == nil || !fsutil.IsRegularFile(path) {
+		return "", nil
+	}
+
+	if current.backups == 0 {
+		if err := current.pruneBackups(); err != nil {
+			return "", err
+		}
+	}
+
+	current.backups++
+
+	dir := filepath.Join(current.BackupsDir(), current.Run)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	location := filepath.Join(dir, strconv.Itoa(current.backups))
+
+	fi, err := os.Stat(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := fsutil.CopyFile(path, location); err != nil {
+		return "", err
+	}
+
+	if err := os.Chmod(location, fi.Mode().Perm()); err != nil {
+		return "", err
+	}
+
+	return location, nil
+}
+
+// record records change that was made already. Failure to record it is
+// remembered to be reported by Err.
+func record(op, path, source, before, backup string) {
+	remember(recordEntry(Entry{
+		Op:     op,
+		Path:   path,
+		Source: source,
+		Before: before,
+		Backup: backup,
+	}))
+}
+
+// remember keeps first error recording of changes ran into.
+func remember(err error) {
+	if current != nil && current.err == nil {
+		current.err = err
+	}
+}
+
+func recordEntry(e Entry) error {
+	if current == nil {
+		return nil
+	}
+
+	e.Run = current.Run
+	e.Time = time.Now()
+	e.Command = current.Command
+	e.Host = host.Name()
+	e.After = Fingerprint(e.Path)
+	e.Undoes = current.Undoes
+
+	return current.append(e)
+}
+
+// Fingerprint returns a string describing current state of given path: MD5
+// hash of content for regular files, target for symlinks, "dir" for
+// directories and empty string for paths that do not exist.
+func Fingerprint(path string) string {
+	fi, err := os.Lstat(path)
+
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, _ := os.Readlink(path)
+		return "link:" + target
+	case fi.IsDir():
+		return "dir"
+	case fi.Mode().IsRegular():
+		sum, err := fsutil.MD5(path)
+		if err != nil {
+			return "file"
+		}
+		return "md5:" + hex.EncodeToString(sum)
+	}
+
+	return "special"
+}
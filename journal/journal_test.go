@@ -0,0 +1,209 @@
+package journal_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/vderyagin/dfm/fsutil"
+	. "github.com/vderyagin/dfm/journal"
+	. "github.com/vderyagin/dfm/testutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Journal", func() {
+	ExecuteEachInTempDir()
+
+	BeforeEach(func() {
+		Start("state", []string{"dfm", "test"})
+	})
+
+	AfterEach(func() {
+		Stop()
+	})
+
+	entries := func() []Entry {
+		e, err := Current().Entries()
+		Expect(err).To(Succeed())
+		return e
+	}
+
+	Describe("Start", func() {
+		It("does not create journal directory until something is recorded", func() {
+			Expect(fsutil.Exists("state")).To(BeFalse())
+			Expect(entries()).To(BeEmpty())
+		})
+
+		It("makes journal directory absolute", func() {
+			Expect(filepath.IsAbs(Current().Dir)).To(BeTrue())
+		})
+	})
+
+	Describe("Stop", func() {
+		It("disables recording", func() {
+			Stop()
+			CreateFile("foo")
+			Expect(Remove("foo")).To(Succeed())
+			Expect(fsutil.Exists("state")).To(BeFalse())
+		})
+	})
+
+	Describe("Fingerprint", func() {
+		It("returns empty string for nonexistent path", func() {
+			Expect(Fingerprint("nonexistent")).To(BeEmpty())
+		})
+
+		It("returns content hash for regular files", func() {
+			CreateFileWithContent("foo", []byte("foo"))
+			Expect(Fingerprint("foo")).To(Equal("md5:acbd18db4cc2f85cedef654fccc4a4d8"))
+		})
+
+		It("returns target for symlinks", func() {
+			os.Symlink("foo", "bar")
+			Expect(Fingerprint("bar")).To(Equal("link:foo"))
+		})
+
+		It("returns \"dir\" for directories", func() {
+			CreateDir("foo")
+			Expect(Fingerprint("foo")).To(Equal("dir"))
+		})
+	})
+
+	Describe("Symlink", func() {
+		It("creates symlink and records it", func() {
+			Expect(Symlink("foo", "bar")).To(Succeed())
+			Expect(fsutil.IsSymlink("bar")).To(BeTrue())
+
+			e := entries()
+			Expect(e).To(HaveLen(1))
+			Expect(e[0].Op).To(Equal(OpSymlink))
+			Expect(e[0].Path).To(Equal("bar"))
+			Expect(e[0].Source).To(Equal("foo"))
+			Expect(e[0].Before).To(BeEmpty())
+			Expect(e[0].After).To(Equal("link:foo"))
+			Expect(e[0].Command).To(Equal([]string{"dfm", "test"}))
+			Expect(e[0].Run).To(Equal(Current().Run))
+		})
+	})
+
+	Describe("Rename", func() {
+		It("moves file and records content hashes", func() {
+			CreateFileWithContent("foo", []byte("foo"))
+
+			Expect(Rename("foo", "bar")).To(Succeed())
+
+			e := entries()
+			Expect(e).To(HaveLen(1))
+			Expect(e[0].Op).To(Equal(OpRename))
+			Expect(e[0].Path).To(Equal("bar"))
+			Expect(e[0].Source).To(Equal("foo"))
+			Expect(e[0].After).To(Equal("md5:acbd18db4cc2f85cedef654fccc4a4d8"))
+		})
+
+		It("does not record failed operations", func() {
+			Expect(Rename("foo", "bar")).NotTo(Succeed())
+			Expect(entries()).To(BeEmpty())
+		})
+	})
+
+	Describe("Err", func() {
+		It("is set if change can not be recorded, without change being reverted", func() {
+			CreateFile("file")
+			Start("file/state", []string{"dfm", "test"})
+
+			Expect(Symlink("foo", "link")).To(Succeed())
+			Expect(os.Readlink("link")).To(Equal("foo"))
+			Expect(Err()).NotTo(Succeed())
+		})
+
+		It("is nil if every change got recorded", func() {
+			Expect(Symlink("foo", "link")).To(Succeed())
+			Expect(Err()).To(Succeed())
+		})
+	})
+
+	Describe("Remove", func() {
+		It("records hash of removed file", func() {
+			CreateFileWithContent("foo", []byte("foo"))
+
+			Expect(Remove("foo")).To(Succeed())
+
+			e := entries()
+			Expect(e).To(HaveLen(1))
+			Expect(e[0].Op).To(Equal(OpRemove))
+			Expect(e[0].Before).To(Equal("md5:acbd18db4cc2f85cedef654fccc4a4d8"))
+			Expect(e[0].After).To(BeEmpty())
+		})
+
+		It("records removal of directories as rmdir", func() {
+			CreateDir("foo")
+
+			Expect(Remove("foo")).To(Succeed())
+			Expect(entries()[0].Op).To(Equal(OpRmdir))
+		})
+	})
+
+	Describe("RemoveAll", func() {
+		It("records removal of every nested file and directory", func() {
+			CreateFile("foo/bar/baz")
+
+			Expect(RemoveAll("foo")).To(Succeed())
+			Expect(fsutil.Exists("foo")).To(BeFalse())
+
+			e := entries()
+			Expect(e).To(HaveLen(3))
+			Expect(e[0].Path).To(Equal("foo/bar/baz"))
+			Expect(e[2].Path).To(Equal("foo"))
+		})
+
+		It("does nothing if path does not exist", func() {
+			Expect(RemoveAll("foo")).To(Succeed())
+			Expect(entries()).To(BeEmpty())
+		})
+	})
+
+	Describe("CopyAll", func() {
+		It("copies every nested file and symlink, preserving modes", func() {
+			CreateFileWithContent("foo/bar/baz", []byte("baz"))
+			os.Chmod("foo/bar/baz", 0755)
+			os.Symlink("baz", "foo/bar/link")
+
+			Expect(CopyAll("foo", "copy")).To(Succeed())
+			Expect(os.ReadFile("copy/bar/baz")).To(Equal([]byte("baz")))
+			Expect(os.Readlink("copy/bar/link")).To(Equal("baz"))
+
+			fi, _ := os.Stat("copy/bar/baz")
+			Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0755)))
+			Expect(fsutil.Exists("foo/bar/baz")).To(BeTrue())
+		})
+	})
+
+	Describe("MkdirAll", func() {
+		It("records every created directory, outermost first", func() {
+			CreateDir("foo")
+
+			Expect(MkdirAll("foo/bar/baz", 0777)).To(Succeed())
+
+			e := entries()
+			Expect(e).To(HaveLen(2))
+			Expect(e[0].Op).To(Equal(OpMkdir))
+			Expect(e[0].Path).To(Equal("foo/bar"))
+			Expect(e[1].Path).To(Equal("foo/bar/baz"))
+		})
+	})
+
+	Describe("DeleteEmptyDirs", func() {
+		It("records every removed directory", func() {
+			CreateDir("foo/bar/baz")
+			CreateFile("foo/file")
+
+			Expect(DeleteEmptyDirs("foo/bar/baz")).To(Succeed())
+
+			e := entries()
+			Expect(e).To(HaveLen(2))
+			Expect(e[0].Path).To(Equal("foo/bar/baz"))
+			Expect(e[1].Path).To(Equal("foo/bar"))
+		})
+	})
+})
@@ -0,0 +1,281 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/vderyagin/dfm/fsutil"
+)
+
+// Symlink creates symlink at link pointing to target and records it.
+func Symlink(target, link string) error {
+	before := Fingerprint(link)
+
+	if err := os.Symlink(target, link); err != nil {
+		return err
+	}
+
+	record(OpSymlink, link, target, before, "")
+
+	return nil
+}
+
+// Link creates hard link at link to file at target and records it.
+func Link(target, link string) error {
+	before := Fingerprint(link)
+
+	if err := os.Link(target, link); err != nil {
+		return err
+	}
+
+	record(OpHardlink, link, target, before, "")
+
+	return nil
+}
+
+// ReplaceSymlink atomically replaces whatever is at link with symlink
+// pointing to target.
+func ReplaceSymlink(target, link string) error {
+	tmp := link + ".dfm-tmp"
+
+	if err := Symlink(target, tmp); err != nil {
+		return err
+	}
+
+	return Rename(tmp, link)
+}
+
+// Rename renames (moves) oldpath to newpath and records it, backing up file
+// at newpath if it gets overwritten.
+func Rename(oldpath, newpath string) error {
+	before := Fingerprint(newpath)
+	saved, err := backup(newpath)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+
+	record(OpRename, newpath, oldpath, before, saved)
+
+	return nil
+}
+
+// CopyFile copies file src to dst and records it, backing up dst if it gets
+// overwritten.
+func CopyFile(src, dst string) error {
+	before := Fingerprint(dst)
+	saved, err := backup(dst)
+
+	if err != nil {
+		return err
+	}
+
+	if err := fsutil.CopyFile(src, dst); err != nil {
+		return err
+	}
+
+	record(OpCopy, dst, src, before, saved)
+
+	return nil
+}
+
+// WriteFile writes content to file at path and records it, backing up
+// previous content of file.
+func WriteFile(path string, content []byte, perm os.FileMode) error {
+	before := Fingerprint(path)
+	saved, err := backup(path)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, content, perm); err != nil {
+		return err
+	}
+
+	record(OpWrite, path, "", before, saved)
+
+	return nil
+}
+
+// Remove removes file or empty directory at given path and records it,
+// backing up removed regular file.
+func Remove(path string) error {
+	before := Fingerprint(path)
+	op := OpRemove
+
+	if before == "dir" {
+		op = OpRmdir
+	}
+
+	saved, err := backup(path)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	record(op, path, "", before, saved)
+
+	return nil
+}
+
+// RemoveAll removes path and everything it contains, recording removal of
+// every file and directory separately. Does nothing if path does not exist.
+func RemoveAll(path string) error {
+	var paths []string
+
+	err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		paths = append(paths, p)
+
+		return nil
+	})
+
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for i := len(paths) - 1; i >= 0; i-- {
+		if err := Remove(paths[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CopyAll copies file or directory src with everything it contains to dst,
+// recording creation of every file and directory separately. Modes of
+// copied files and directories are preserved.
+func CopyAll(src, dst string) error {
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case fi.IsDir():
+			return MkdirAll(target, fi.Mode().Perm())
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+
+			if err != nil {
+				return err
+			}
+
+			return Symlink(link, target)
+		}
+
+		if err := CopyFile(p, target); err != nil {
+			return err
+		}
+
+		if copied, err := os.Stat(target); err != nil || copied.Mode().Perm() == fi.Mode().Perm() {
+			return err
+		}
+
+		return Chmod(target, fi.Mode().Perm())
+	})
+}
+
+// Chmod changes mode of file at given path (following symlinks) and records
+// it along with previous mode.
+func Chmod(path string, mode os.FileMode) error {
+	fi, err := os.Stat(path)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+
+	remember(recordEntry(Entry{
+		Op:       OpChmod,
+		Path:     path,
+		Previous: fmt.Sprintf("%04o", fi.Mode().Perm()),
+	}))
+
+	return nil
+}
+
+// Chown changes owner and group of file at given path (following symlinks)
+// and records it along with previous ones.
+func Chown(path string, uid, gid int) error {
+	prevUID, prevGID, err := fsutil.Owner(path)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chown(path, uid, gid); err != nil {
+		return err
+	}
+
+	remember(recordEntry(Entry{
+		Op:       OpChown,
+		Path:     path,
+		Previous: fmt.Sprintf("%d:%d", prevUID, prevGID),
+	}))
+
+	return nil
+}
+
+// MkdirAll creates directory with all necessary parents, recording creation
+// of every directory that did not exist before.
+func MkdirAll(path string, perm os.FileMode) error {
+	var missing []string
+
+	for dir := path; !fsutil.Exists(dir); dir = filepath.Dir(dir) {
+		missing = append(missing, dir)
+
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	if err := os.MkdirAll(path, perm); err != nil {
+		return err
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		record(OpMkdir, missing[i], "", "", "")
+	}
+
+	return nil
+}
+
+// DeleteEmptyDirs works like fsutil.DeleteEmptyDirs, recording every
+// directory it removes.
+func DeleteEmptyDirs(start string) error {
+	for dir := start; fsutil.IsEmptyDir(dir); dir = filepath.Dir(dir) {
+		if err := Remove(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
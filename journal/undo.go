@@ -0,0 +1,302 @@
+package journal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vderyagin/dfm/fsutil"
+)
+
+// History is a number of most recent runs that can be undone.
+const History = 10
+
+// Run is a group of changes made during single invocation of dfm. Reverted
+// is a number of its most recent changes that were reverted by attempts to
+// undo it that failed midway.
+type Run struct {
+	ID       string
+	Time     time.Time
+	Command  []string
+	Entries  []Entry
+	Reverted int
+}
+
+// IsUndo returns true if run was made while undoing some other run.
+func (r *Run) IsUndo() bool {
+	return len(r.Entries) > 0 && r.Entries[0].Undoes != ""
+}
+
+// ChangedError is returned when filesystem changed since the moment run was
+// recorded, so it can not be safely undone.
+type ChangedError string
+
+func (e ChangedError) Error() string {
+	return fmt.Sprintf("%s changed since it was recorded", string(e))
+}
+
+// Runs returns all runs recorded in journal, oldest first.
+func (j *Journal) Runs() ([]Run, error) {
+	var runs []Run
+
+	entries, err := j.Entries()
+
+	if err != nil {
+		return runs, err
+	}
+
+	for _, e := range entries {
+		if len(runs) == 0 || runs[len(runs)-1].ID != e.Run {
+			runs = append(runs, Run{ID: e.Run, Time: e.Time, Command: e.Command})
+		}
+
+		runs[len(runs)-1].Entries = append(runs[len(runs)-1].Entries, e)
+	}
+
+	return runs, nil
+}
+
+// UndoableRuns returns runs that can still be undone, most recent first.
+// Only History most recent runs are considered, runs made while undoing and
+// runs that were undone completely are excluded, partially undone ones have
+// Reverted set.
+func (j *Journal) UndoableRuns() ([]Run, error) {
+	var result []Run
+
+	runs, err := j.Runs()
+
+	if err != nil {
+		return result, err
+	}
+
+	reverted := make(map[string]int)
+
+	for _, r := range runs {
+		for _, e := range r.Entries {
+			if e.Op == OpUndo {
+				reverted[e.Undoes], _ = strconv.Atoi(e.Previous)
+			}
+		}
+	}
+
+	for i, considered := len(runs)-1, 0; i >= 0 && considered < History; i-- {
+		if runs[i].IsUndo() {
+			continue
+		}
+
+		considered++
+
+		if reverted[runs[i].ID] < len(runs[i].Entries) {
+			runs[i].Reverted = reverted[runs[i].ID]
+			result = append(result, runs[i])
+		}
+	}
+
+	return result, nil
+}
+
+// Undo reverts all changes made during given run (but ones reverted
+// already), recording reverting changes in current journal. Refuses to do
+// anything if any of the paths involved changed since run was recorded. Run
+// counts as undone only if all of its changes got reverted, otherwise undoing
+// it again picks up where this attempt stopped.
+func Undo(run Run) error {
+	if current == nil {
+		return errors.New("journal is not started")
+	}
+
+	if err := verify(run); err != nil {
+		return err
+	}
+
+	current.Undoes = run.ID
+	defer func() { current.Undoes = "" }()
+
+	reverted := run.Reverted
+	var err error
+
+	for i := len(run.Entries) - 1 - reverted; i >= 0 && err == nil; i-- {
+		if err = revert(run.Entries[i]); err == nil {
+			reverted++
+		}
+	}
+
+	if recordErr := recordEntry(Entry{Op: OpUndo, Previous: strconv.Itoa(reverted)}); err == nil {
+		err = recordErr
+	}
+
+	return err
+}
+
+// verify makes sure that state of filesystem is exactly the one run (and
+// earlier attempts to undo it) left it in, that every removed or overwritten
+// file can be brought back and that created directories contain nothing but
+// what run put there.
+func verify(run Run) error {
+	expected := make(map[string]string)
+	cleared := make(map[string]bool)
+	pending := run.Entries[:len(run.Entries)-run.Reverted]
+
+	for _, e := range pending {
+		expected[e.Path] = e.After
+
+		if e.Op == OpRename {
+			expected[e.Source] = ""
+		}
+
+		if strings.HasPrefix(e.Before, "md5:") && !fsutil.IsRegularFile(e.Backup) {
+			return fmt.Errorf("no backup of %s", e.Path)
+		}
+
+		if e.Before == "" && e.Op != OpChmod && e.Op != OpChown {
+			cleared[e.Path] = true
+		}
+	}
+
+	for i := len(run.Entries) - 1; i >= len(pending); i-- {
+		e := run.Entries[i]
+
+		switch e.Op {
+		case OpChmod, OpChown:
+			expected[e.Path] = e.After
+		case OpRename:
+			expected[e.Path] = e.Before
+			expected[e.Source] = e.After
+		default:
+			expected[e.Path] = e.Before
+		}
+	}
+
+	for path, fingerprint := range expected {
+		if Fingerprint(path) != fingerprint {
+			return ChangedError(path)
+		}
+	}
+
+	for _, e := range pending {
+		if e.Op != OpMkdir {
+			continue
+		}
+
+		entries, _ := os.ReadDir(e.Path)
+
+		for _, entry := range entries {
+			if child := filepath.Join(e.Path, entry.Name()); !cleared[child] {
+				return ChangedError(child)
+			}
+		}
+	}
+
+	return nil
+}
+
+func revert(e Entry) error {
+	switch e.Op {
+	case OpSymlink, OpHardlink, OpMkdir:
+		return Remove(e.Path)
+	case OpRename:
+		if err := Rename(e.Path, e.Source); err != nil {
+			return err
+		}
+	case OpCopy, OpWrite:
+		if e.Before == "" {
+			return Remove(e.Path)
+		}
+
+		if strings.HasPrefix(e.Before, "link:") {
+			if err := Remove(e.Path); err != nil {
+				return err
+			}
+		}
+	case OpRemove:
+		// Removed file is brought back below.
+	case OpRmdir:
+		return MkdirAll(e.Path, 0777)
+	case OpChmod:
+		mode, err := strconv.ParseUint(e.Previous, 8, 32)
+
+		if err != nil {
+			return err
+		}
+
+		return Chmod(e.Path, os.FileMode(mode))
+	case OpChown:
+		var uid, gid int
+
+		if _, err := fmt.Sscanf(e.Previous, "%d:%d", &uid, &gid); err != nil {
+			return err
+		}
+
+		return Chown(e.Path, uid, gid)
+	default:
+		return fmt.Errorf("unknown operation: %s", e.Op)
+	}
+
+	return bringBack(e)
+}
+
+// bringBack recreates whatever was at entry's path before the change. Files
+// are brought back with mode they had, which is kept by their backups.
+func bringBack(e Entry) error {
+	if strings.HasPrefix(e.Before, "link:") {
+		return Symlink(strings.TrimPrefix(e.Before, "link:"), e.Path)
+	}
+
+	if e.Backup == "" {
+		return nil
+	}
+
+	fi, err := os.Stat(e.Backup)
+
+	if err != nil {
+		return err
+	}
+
+	if err := CopyFile(e.Backup, e.Path); err != nil {
+		return err
+	}
+
+	return os.Chmod(e.Path, fi.Mode().Perm())
+}
+
+// pruneBackups removes backups of runs that can no longer be undone.
+func (j *Journal) pruneBackups() error {
+	runs, err := j.Runs()
+
+	if err != nil {
+		return err
+	}
+
+	keep := map[string]bool{j.Run: true}
+
+	for i, kept := len(runs)-1, 0; i >= 0 && kept < History; i-- {
+		if !runs[i].IsUndo() {
+			keep[runs[i].ID] = true
+			kept++
+		}
+	}
+
+	dirs, err := os.ReadDir(j.BackupsDir())
+
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		if keep[dir.Name()] {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(j.BackupsDir(), dir.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
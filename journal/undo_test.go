@@ -0,0 +1,247 @@
+package journal_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/vderyagin/dfm/fsutil"
+	. "github.com/vderyagin/dfm/journal"
+	. "github.com/vderyagin/dfm/testutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Undo", func() {
+	ExecuteEachInTempDir()
+
+	AfterEach(func() {
+		Stop()
+	})
+
+	// run starts new journal run and executes given function within it,
+	// returning the run.
+	run := func(f func()) Run {
+		Start("state", []string{"dfm"})
+		f()
+		runs, err := Current().UndoableRuns()
+		Expect(err).To(Succeed())
+		Expect(runs).NotTo(BeEmpty())
+		return runs[0]
+	}
+
+	undoLast := func() error {
+		Start("state", []string{"dfm", "undo"})
+		runs, err := Current().UndoableRuns()
+		Expect(err).To(Succeed())
+		Expect(runs).NotTo(BeEmpty())
+		return Undo(runs[0])
+	}
+
+	content := func(path string) string {
+		c, _ := ioutil.ReadFile(path)
+		return string(c)
+	}
+
+	It("reverts rename and symlink", func() {
+		CreateFileWithContent(".foo", []byte("foo"))
+
+		run(func() {
+			Expect(Rename(".foo", "foo")).To(Succeed())
+			Expect(Symlink("foo", ".foo")).To(Succeed())
+		})
+
+		Expect(undoLast()).To(Succeed())
+		Expect(fsutil.IsRegularFile(".foo")).To(BeTrue())
+		Expect(content(".foo")).To(Equal("foo"))
+		Expect(fsutil.Exists("foo")).To(BeFalse())
+	})
+
+	It("brings back removed files and directories", func() {
+		CreateFileWithContent("dir/foo", []byte("foo"))
+		os.Symlink("foo", "dir/bar")
+
+		run(func() {
+			Expect(RemoveAll("dir")).To(Succeed())
+		})
+
+		Expect(undoLast()).To(Succeed())
+		Expect(content("dir/foo")).To(Equal("foo"))
+		Expect(os.Readlink("dir/bar")).To(Equal("foo"))
+	})
+
+	It("brings back removed and overwritten files with their modes", func() {
+		CreateFileWithContent("netrc", []byte("secret"))
+		CreateFileWithContent("config", []byte("config"))
+		CreateFileWithContent("other", []byte("other"))
+		os.Chmod("netrc", 0600)
+		os.Chmod("config", 0600)
+
+		run(func() {
+			Expect(Remove("netrc")).To(Succeed())
+			Expect(Rename("other", "config")).To(Succeed())
+		})
+
+		Expect(undoLast()).To(Succeed())
+
+		for _, path := range []string{"netrc", "config"} {
+			fi, err := os.Stat(path)
+			Expect(err).To(Succeed())
+			Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		}
+
+		Expect(content("config")).To(Equal("config"))
+	})
+
+	It("reverts mode changes", func() {
+		CreateFile("foo")
+		os.Chmod("foo", 0644)
+
+		run(func() {
+			Expect(Chmod("foo", 0600)).To(Succeed())
+		})
+
+		Expect(undoLast()).To(Succeed())
+
+		fi, _ := os.Stat("foo")
+		Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0644)))
+	})
+
+	It("brings back overwritten files", func() {
+		CreateFileWithContent("foo", []byte("foo"))
+		CreateFileWithContent("bar", []byte("bar"))
+
+		run(func() {
+			Expect(CopyFile("foo", "bar")).To(Succeed())
+		})
+
+		Expect(content("bar")).To(Equal("foo"))
+		Expect(undoLast()).To(Succeed())
+		Expect(content("bar")).To(Equal("bar"))
+	})
+
+	It("brings back rewritten files", func() {
+		CreateFileWithContent("foo", []byte("foo"))
+
+		run(func() {
+			Expect(WriteFile("foo", []byte("bar"), 0666)).To(Succeed())
+		})
+
+		Expect(content("foo")).To(Equal("bar"))
+		Expect(undoLast()).To(Succeed())
+		Expect(content("foo")).To(Equal("foo"))
+	})
+
+	It("brings back replaced symlinks", func() {
+		os.Symlink("foo", "link")
+
+		run(func() {
+			Expect(ReplaceSymlink("bar", "link")).To(Succeed())
+		})
+
+		Expect(os.Readlink("link")).To(Equal("bar"))
+		Expect(undoLast()).To(Succeed())
+		Expect(os.Readlink("link")).To(Equal("foo"))
+		Expect(fsutil.Exists("link.dfm-tmp")).To(BeFalse())
+	})
+
+	It("removes created directories", func() {
+		run(func() {
+			Expect(MkdirAll("foo/bar", 0777)).To(Succeed())
+		})
+
+		Expect(undoLast()).To(Succeed())
+		Expect(fsutil.Exists("foo")).To(BeFalse())
+	})
+
+	It("refuses to undo if filesystem changed since", func() {
+		CreateFileWithContent("foo", []byte("foo"))
+
+		run(func() {
+			Expect(Rename("foo", "bar")).To(Succeed())
+		})
+
+		CreateFileWithContent("bar", []byte("changed"))
+
+		Expect(undoLast()).To(BeAssignableToTypeOf(ChangedError("")))
+		Expect(content("bar")).To(Equal("changed"))
+		Expect(fsutil.Exists("foo")).To(BeFalse())
+	})
+
+	It("refuses to remove created directories that got something else in them", func() {
+		run(func() {
+			Expect(MkdirAll("foo", 0777)).To(Succeed())
+			Expect(Symlink("x", "foo/link")).To(Succeed())
+		})
+
+		CreateFile("foo/bar")
+
+		Expect(undoLast()).To(BeAssignableToTypeOf(ChangedError("")))
+		Expect(os.Readlink("foo/link")).To(Equal("x"))
+	})
+
+	It("picks up where failed attempt to undo stopped", func() {
+		CreateFile("dir/foo")
+
+		run(func() {
+			Expect(Rename("dir/foo", "bar")).To(Succeed())
+			Expect(Symlink("bar", "link")).To(Succeed())
+		})
+
+		os.Remove("dir")
+
+		Expect(undoLast()).NotTo(Succeed())
+		Expect(fsutil.Exists("link")).To(BeFalse())
+
+		Start("state", []string{"dfm", "undo"})
+		runs, err := Current().UndoableRuns()
+		Expect(err).To(Succeed())
+		Expect(runs).To(HaveLen(1))
+		Expect(runs[0].Reverted).To(Equal(1))
+
+		CreateDir("dir")
+
+		Expect(undoLast()).To(Succeed())
+		Expect(fsutil.Exists("dir/foo")).To(BeTrue())
+
+		runs, err = Current().UndoableRuns()
+		Expect(err).To(Succeed())
+		Expect(runs).To(BeEmpty())
+	})
+
+	Describe("UndoableRuns", func() {
+		It("does not include undone runs and runs made while undoing", func() {
+			CreateFile("foo")
+
+			first := run(func() {
+				Expect(Rename("foo", "bar")).To(Succeed())
+			})
+
+			run(func() {
+				Expect(Rename("bar", "baz")).To(Succeed())
+			})
+
+			Expect(undoLast()).To(Succeed())
+
+			runs, err := Current().UndoableRuns()
+			Expect(err).To(Succeed())
+			Expect(runs).To(HaveLen(1))
+			Expect(runs[0].ID).To(Equal(first.ID))
+		})
+
+		It("includes only limited number of most recent runs", func() {
+			CreateFile("foo")
+
+			for i := 0; i < History+2; i++ {
+				run(func() {
+					Expect(Symlink("foo", "bar")).To(Succeed())
+					Expect(Remove("bar")).To(Succeed())
+				})
+			}
+
+			runs, err := Current().UndoableRuns()
+			Expect(err).To(Succeed())
+			Expect(runs).To(HaveLen(History))
+		})
+	})
+})
@@ -30,6 +30,11 @@ func (l *Logger) Skip(msg, reason string) {
 	fmt.Printf("%s: %s\n\t(%s)\n", ansi.Color(msg, "yellow+b"), l, reason)
 }
 
+// Warn logs something worth attention about successful action.
+func (l *Logger) Warn(msg, reason string) {
+	fmt.Printf("%s: %s\n\t(%s)\n", ansi.Color(msg, "magenta+b"), l, reason)
+}
+
 // String representation of logger.
 func (l *Logger) String() string {
 	return string(*l)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"os/user"
@@ -9,6 +10,7 @@ import (
 	"github.com/urfave/cli"
 
 	"github.com/vderyagin/dfm/commands"
+	"github.com/vderyagin/dfm/journal"
 )
 
 func homeDir() string {
@@ -21,6 +23,14 @@ func homeDir() string {
 	return usr.HomeDir
 }
 
+func stateDir() string {
+	if xdgState := os.Getenv("XDG_STATE_HOME"); len(xdgState) != 0 {
+		return filepath.Join(xdgState, "dfm")
+	}
+
+	return filepath.Join(homeDir(), ".local", "state", "dfm")
+}
+
 var appFlags = []cli.Flag{
 	cli.StringFlag{
 		Name:   "home",
@@ -28,12 +38,24 @@ var appFlags = []cli.Flag{
 		Usage:  "home directory",
 		EnvVar: "DOTFILES_HOME_DIR",
 	},
-	cli.StringFlag{
+	cli.StringSliceFlag{
 		Name:   "store",
-		Value:  filepath.Join(homeDir(), ".dotfiles"),
-		Usage:  "directory files will be stored in",
+		Value:  &cli.StringSlice{filepath.Join(homeDir(), ".dotfiles")},
+		Usage:  "directory files will be stored in, repeat to layer several of them, highest priority first",
 		EnvVar: "DOTFILES_STORE_DIR",
 	},
+	cli.StringFlag{
+		Name:   "state",
+		Value:  stateDir(),
+		Usage:  "directory journal of performed changes is kept in",
+		EnvVar: "DOTFILES_STATE_DIR",
+	},
+	cli.StringFlag{
+		Name:   "link-style",
+		Value:  "absolute",
+		Usage:  "style of symlinks to stored files (absolute or relative)",
+		EnvVar: "DOTFILES_LINK_STYLE",
+	},
 }
 
 var appCommands = []cli.Command{
@@ -42,6 +64,12 @@ var appCommands = []cli.Command{
 		ShortName: "l",
 		Usage:     "List stored dotfiles",
 		Action:    commands.List,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "long",
+				Usage: "show attributes of files from store metadata",
+			},
+		},
 	},
 	{
 		Name:      "store",
@@ -61,6 +89,22 @@ var appCommands = []cli.Command{
 				Name:  "copy",
 				Usage: "make sure this file always gets copied, not symlinked",
 			},
+			cli.BoolFlag{
+				Name:  "fold",
+				Usage: "store directories as a whole, linking them with a single symlink",
+			},
+			cli.BoolFlag{
+				Name:  "hardlink",
+				Usage: "link this file with hard link, not symlink",
+			},
+			cli.BoolFlag{
+				Name:  "symlink",
+				Usage: "store symlinks as such, recording their targets",
+			},
+			cli.StringFlag{
+				Name:  "into",
+				Usage: "store into given one of stores, regardless of their rules",
+			},
 		},
 	},
 	{
@@ -68,6 +112,16 @@ var appCommands = []cli.Command{
 		ShortName: "r",
 		Usage:     "Move file to its original location",
 		Action:    commands.Restore,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "all",
+				Usage: "restore all stored files",
+			},
+			cli.StringFlag{
+				Name:  "only",
+				Usage: "with --all, restore only files of given variant (generic, host-specific, copy or alias)",
+			},
+		},
 	},
 	{
 		Name:   "link",
@@ -78,6 +132,113 @@ var appCommands = []cli.Command{
 				Name:  "force",
 				Usage: "overwrite conflicting files if necessary",
 			},
+			cli.BoolFlag{
+				Name:  "adopt",
+				Usage: "replace conflicting files if they are identical to stored ones",
+			},
+		},
+	},
+	{
+		Name:   "adopt",
+		Usage:  "Link all stored files, replacing identical files found in their places",
+		Action: commands.Adopt,
+	},
+	{
+		Name:   "mv",
+		Usage:  "Rename or relocate stored file, with all its variants and aliases",
+		Action: commands.Move,
+	},
+	{
+		Name:   "convert",
+		Usage:  "Turn stored files into their generic, host-specific, copied or symlinked variants",
+		Action: commands.Convert,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "to-host-specific",
+				Usage: "make files specific to this host",
+			},
+			cli.BoolFlag{
+				Name:  "to-generic",
+				Usage: "make files shared by all hosts",
+			},
+			cli.BoolFlag{
+				Name:  "to-copy",
+				Usage: "make files always get copied, not symlinked",
+			},
+			cli.BoolFlag{
+				Name:  "to-link",
+				Usage: "make files get symlinked",
+			},
+			cli.BoolFlag{
+				Name:  "force",
+				Usage: "overwrite stored files of requested variant if necessary",
+			},
+		},
+	},
+	{
+		Name:   "promote",
+		Usage:  "Make host-specific variants of files generic ones",
+		Action: commands.Promote,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "interactive, i",
+				Usage: "merge changes into generic files one by one instead of replacing them",
+			},
+		},
+	},
+	{
+		Name:  "alias",
+		Usage: "Manage aliases, stored files linked to more than one location",
+		Subcommands: []cli.Command{
+			{
+				Name:      "add",
+				Usage:     "Make stored file available at another location",
+				ArgsUsage: "TARGET NEW_HOME_PATH",
+				Action:    commands.AliasAdd,
+			},
+			{
+				Name:   "list",
+				Usage:  "List aliases with files they point to",
+				Action: commands.AliasList,
+			},
+			{
+				Name:   "rm",
+				Usage:  "Remove aliases, keeping files they point to",
+				Action: commands.AliasRemove,
+			},
+		},
+	},
+	{
+		Name:   "relink",
+		Usage:  "Replace symlinks to stored files with absolute or relative ones",
+		Action: commands.Relink,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "style",
+				Usage: "style of symlinks (absolute or relative), style files are linked in by default",
+			},
+		},
+	},
+	{
+		Name:   "relocate",
+		Usage:  "Repoint symlinks to files in store that was moved to its current location",
+		Action: commands.Relocate,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "from",
+				Usage: "former location of store, guessed from existing symlinks by default",
+			},
+		},
+	},
+	{
+		Name:   "unlink",
+		Usage:  "Remove links to stored files, keeping store intact",
+		Action: commands.Unlink,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "all",
+				Usage: "unlink all stored files",
+			},
 		},
 	},
 	{
@@ -86,6 +247,54 @@ var appCommands = []cli.Command{
 		Usage:     "Delete given files from home and store",
 		Action:    commands.Delete,
 	},
+	{
+		Name:   "reabsorb",
+		Usage:  "Move files that replaced symlinks into store and link them back",
+		Action: commands.Reabsorb,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "interactive, i",
+				Usage: "ask for confirmation for every file",
+			},
+		},
+	},
+	{
+		Name:   "prune",
+		Usage:  "Remove links to files that are no longer in store",
+		Action: commands.Prune,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "only show what would be removed",
+			},
+		},
+	},
+	{
+		Name:   "log",
+		Usage:  "Show journal of changes made to filesystem",
+		Action: commands.Log,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "since",
+				Usage: "show only changes made at or after given time",
+			},
+			cli.StringFlag{
+				Name:  "until",
+				Usage: "show only changes made at or before given time",
+			},
+		},
+	},
+	{
+		Name:   "undo",
+		Usage:  "Revert changes made by most recent run",
+		Action: commands.Undo,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "list",
+				Usage: "list runs that can be undone, most recent first",
+			},
+		},
+	},
 }
 
 func main() {
@@ -97,6 +306,14 @@ func main() {
 	app.Version = "0.3.0"
 	app.Flags = appFlags
 	app.Commands = appCommands
+	app.Before = func(c *cli.Context) error {
+		return journal.Start(c.GlobalString("state"), os.Args)
+	}
 
 	app.Run(os.Args)
+
+	if err := journal.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to record changes in journal:", err)
+		os.Exit(1)
+	}
 }
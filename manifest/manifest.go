@@ -0,0 +1,183 @@
+package manifest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/fsutil"
+)
+
+// Entry describes a file dfm created in home directory: either a symlink
+// pointing to Target or a copy (or hard link) of Stored file with content
+// hash Hash.
+type Entry struct {
+	Original string `json:"original"`
+	Stored   string `json:"stored"`
+	Target   string `json:"target,omitempty"`
+	Copy     bool   `json:"copy,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// IsUnmodified returns true if file at original location is still exactly
+// what dfm created there.
+func (e *Entry) IsUnmodified() bool {
+	if e.Copy {
+		if !fsutil.IsRegularFile(e.Original) {
+			return false
+		}
+
+		sum, err := fsutil.MD5(e.Original)
+
+		return err == nil && hex.EncodeToString(sum) == e.Hash
+	}
+
+	target, err := fsutil.ResolveSymlink(e.Original)
+
+	return err == nil && target == e.Target
+}
+
+// Manifest keeps track of files dfm linked or copied into home directory on
+// this machine, so that they can be found after their stored counterparts
+// disappear from the store.
+type Manifest struct {
+	Path    string
+	Entries map[string]Entry
+}
+
+// Load reads manifest from given file, missing file is treated as empty
+// manifest.
+func Load(path string) (*Manifest, error) {
+	m := &Manifest{
+		Path:    path,
+		Entries: make(map[string]Entry),
+	}
+
+	content, err := os.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		m.Entries[e.Original] = e
+	}
+
+	return m, nil
+}
+
+// Save writes manifest back to file it was loaded from.
+func (m *Manifest) Save() error {
+	entries := m.Sorted()
+
+	content, err := json.MarshalIndent(entries, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.Path), 0700); err != nil {
+		return err
+	}
+
+	tmp := m.Path + ".tmp"
+
+	if err := os.WriteFile(tmp, append(content, '\n'), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, m.Path)
+}
+
+// Sorted returns all entries sorted by original location.
+func (m *Manifest) Sorted() []Entry {
+	entries := make([]Entry, 0, len(m.Entries))
+
+	for _, e := range m.Entries {
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Original < entries[j].Original
+	})
+
+	return entries
+}
+
+// Add records linked dotfile in manifest.
+func (m *Manifest) Add(df *dotfile.DotFile) {
+	e := Entry{
+		Original: df.OriginalLocation,
+		Stored:   df.StoredLocation,
+	}
+
+	if df.MustBeCopied() || df.MustBeHardlinked() {
+		e.Copy = true
+
+		if sum, err := fsutil.MD5(df.OriginalLocation); err == nil {
+			e.Hash = hex.EncodeToString(sum)
+		}
+	} else if df.IsSymlinkEntry() {
+		if target, err := fsutil.ResolveSymlink(df.OriginalLocation); err == nil {
+			e.Target = target
+		}
+	} else if df.IsAlias() {
+		e.Target = df.AliasTarget
+	} else {
+		e.Target = df.StoredLocation
+	}
+
+	m.Entries[e.Original] = e
+}
+
+// Remove forgets about file at given original location.
+func (m *Manifest) Remove(original string) {
+	delete(m.Entries, original)
+}
+
+// RemoveUnder forgets about files within directory at given location.
+func (m *Manifest) RemoveUnder(dir string) {
+	for original := range m.Entries {
+		if fsutil.IsUnder(original, dir) && original != dir {
+			delete(m.Entries, original)
+		}
+	}
+}
+
+// Orphans returns entries for files from given store that are no longer
+// backed by any of given stored dotfiles.
+func (m *Manifest) Orphans(store string, stored []*dotfile.DotFile) []Entry {
+	var orphans []Entry
+
+	backed := make(map[string]string)
+
+	for _, df := range stored {
+		backed[df.OriginalLocation] = df.StoredLocation
+	}
+
+	for _, e := range m.Sorted() {
+		if !strings.HasPrefix(e.Stored, store+string(filepath.Separator)) {
+			continue
+		}
+
+		if s, ok := backed[e.Original]; ok && s == e.Stored {
+			continue
+		}
+
+		orphans = append(orphans, e)
+	}
+
+	return orphans
+}
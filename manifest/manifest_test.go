@@ -0,0 +1,158 @@
+package manifest_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/vderyagin/dfm/dotfile"
+	. "github.com/vderyagin/dfm/manifest"
+	. "github.com/vderyagin/dfm/testutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Manifest", func() {
+	ExecuteEachInTempDir()
+
+	abs := func(path string) string {
+		p, _ := filepath.Abs(path)
+		return p
+	}
+
+	load := func() *Manifest {
+		m, err := Load("state/manifest.json")
+		Expect(err).To(Succeed())
+		return m
+	}
+
+	Describe("Load", func() {
+		It("returns empty manifest if file does not exist", func() {
+			Expect(load().Entries).To(BeEmpty())
+		})
+
+		It("fails for malformed file", func() {
+			CreateFileWithContent("state/manifest.json", []byte("{"))
+			_, err := Load("state/manifest.json")
+			Expect(err).NotTo(Succeed())
+		})
+	})
+
+	Describe("Save", func() {
+		It("persists added entries", func() {
+			m := load()
+			m.Add(dotfile.New(abs("store/foo"), abs("home/.foo")))
+			Expect(m.Save()).To(Succeed())
+
+			e := load().Entries
+			Expect(e).To(HaveLen(1))
+			Expect(e[abs("home/.foo")].Stored).To(Equal(abs("store/foo")))
+			Expect(e[abs("home/.foo")].Target).To(Equal(abs("store/foo")))
+		})
+
+		It("persists removals", func() {
+			m := load()
+			m.Add(dotfile.New(abs("store/foo"), abs("home/.foo")))
+			m.Save()
+
+			m = load()
+			m.Remove(abs("home/.foo"))
+			Expect(m.Save()).To(Succeed())
+
+			Expect(load().Entries).To(BeEmpty())
+		})
+	})
+
+	Describe("Add", func() {
+		It("records alias target as symlink target", func() {
+			m := load()
+			m.Add(&dotfile.DotFile{
+				StoredLocation:   abs("store/bar"),
+				OriginalLocation: abs("home/.bar"),
+				AliasTarget:      abs("store/foo"),
+			})
+
+			Expect(m.Entries[abs("home/.bar")].Target).To(Equal(abs("store/foo")))
+		})
+
+		It("records content hash of copies", func() {
+			CreateFileWithContent("home/.foo", []byte("foo"))
+			m := load()
+			m.Add(dotfile.New(abs("store/foo.force-copy"), abs("home/.foo")))
+
+			e := m.Entries[abs("home/.foo")]
+			Expect(e.Copy).To(BeTrue())
+			Expect(e.Hash).To(Equal("acbd18db4cc2f85cedef654fccc4a4d8"))
+		})
+	})
+
+	Describe("RemoveUnder", func() {
+		It("forgets about files within given directory only", func() {
+			m := load()
+			m.Add(dotfile.New(abs("store/config/nvim"), abs("home/.config/nvim")))
+			m.Add(dotfile.New(abs("store/config/nvim/init.lua"), abs("home/.config/nvim/init.lua")))
+			m.Add(dotfile.New(abs("store/config/nvim/lua/plugins.lua"), abs("home/.config/nvim/lua/plugins.lua")))
+			m.Add(dotfile.New(abs("store/config/nvimrc"), abs("home/.config/nvimrc")))
+
+			m.RemoveUnder(abs("home/.config/nvim"))
+
+			Expect(m.Entries).To(HaveLen(2))
+			Expect(m.Entries).To(HaveKey(abs("home/.config/nvim")))
+			Expect(m.Entries).To(HaveKey(abs("home/.config/nvimrc")))
+		})
+	})
+
+	Describe("IsUnmodified", func() {
+		It("returns true for symlink pointing where it was pointing initially", func() {
+			CreateFile("store/foo")
+			CreateDir("home")
+			os.Symlink(abs("store/foo"), "home/.foo")
+
+			e := Entry{Original: abs("home/.foo"), Target: abs("store/foo")}
+			Expect(e.IsUnmodified()).To(BeTrue())
+		})
+
+		It("returns false for symlink pointing elsewhere", func() {
+			CreateDir("home")
+			os.Symlink(abs("elsewhere"), "home/.foo")
+
+			e := Entry{Original: abs("home/.foo"), Target: abs("store/foo")}
+			Expect(e.IsUnmodified()).To(BeFalse())
+		})
+
+		It("returns false for copies with changed content", func() {
+			CreateFileWithContent("home/.foo", []byte("bar"))
+
+			e := Entry{Original: abs("home/.foo"), Copy: true, Hash: "acbd18db4cc2f85cedef654fccc4a4d8"}
+			Expect(e.IsUnmodified()).To(BeFalse())
+		})
+	})
+
+	Describe("Orphans", func() {
+		It("returns entries not backed by stored dotfiles", func() {
+			m := load()
+			backed := dotfile.New(abs("store/foo"), abs("home/.foo"))
+			m.Add(backed)
+			m.Add(dotfile.New(abs("store/bar"), abs("home/.bar")))
+
+			orphans := m.Orphans(abs("store"), []*dotfile.DotFile{backed})
+			Expect(orphans).To(HaveLen(1))
+			Expect(orphans[0].Original).To(Equal(abs("home/.bar")))
+		})
+
+		It("returns entries whose original location is now backed by other stored file", func() {
+			m := load()
+			m.Add(dotfile.New(abs("store/foo"), abs("home/.foo")))
+
+			current := dotfile.New(abs("store/foo.host-myhost"), abs("home/.foo"))
+			Expect(m.Orphans(abs("store"), []*dotfile.DotFile{current})).To(HaveLen(1))
+		})
+
+		It("ignores entries from other stores", func() {
+			m := load()
+			m.Add(dotfile.New(abs("other/foo"), abs("home/.foo")))
+
+			Expect(m.Orphans(abs("store"), nil)).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,92 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/fsutil"
+	"github.com/vderyagin/dfm/journal"
+)
+
+// Aliases returns sorted locations of every symlink in stores, including
+// ones that are not valid aliases.
+func (r *Repo) Aliases() []string {
+	var aliases []string
+
+	for _, l := range r.Layers() {
+		for symlink := range fsutil.SymlinksIn(l.Store) {
+			aliases = append(aliases, symlink)
+		}
+	}
+
+	sort.Strings(aliases)
+
+	return aliases
+}
+
+// CheckAlias returns error describing why symlink at given location in store
+// is not a valid alias, nil if it is one.
+func (r *Repo) CheckAlias(symlink string) error {
+	if l := r.Layer(symlink); l != r {
+		return l.CheckAlias(symlink)
+	}
+
+	target, err := os.Readlink(symlink)
+
+	if err != nil {
+		return err
+	}
+
+	if filepath.IsAbs(target) {
+		return fmt.Errorf("absolute symlinks are not aliases, make it relative")
+	}
+
+	if !fsutil.IsRelativeSymlinkWithinDir(symlink, r.Store) {
+		return fmt.Errorf("points outside of store")
+	}
+
+	_, err = r.ResolveAlias(symlink)
+
+	return err
+}
+
+// AddAlias makes stored file target available at another original location
+// orig by creating relative symlink to it in store target is in.
+func (r *Repo) AddAlias(target, orig string) (*dotfile.DotFile, error) {
+	if l := r.Layer(target); l != r {
+		return l.AddAlias(target, orig)
+	}
+
+	if !r.IsInStore(target) || !fsutil.IsRegularFile(target) {
+		return nil, fmt.Errorf("%s is not a stored file", target)
+	}
+
+	alias, err := r.genericStoredFilePath(orig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Lstat(alias); !os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s exists already", alias)
+	}
+
+	relTarget, err := filepath.Rel(filepath.Dir(alias), target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := journal.MkdirAll(filepath.Dir(alias), 0777); err != nil {
+		return nil, err
+	}
+
+	if err := journal.Symlink(relTarget, alias); err != nil {
+		return nil, err
+	}
+
+	return r.DotFile(alias), nil
+}
@@ -0,0 +1,90 @@
+package repo_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/vderyagin/dfm/repo"
+	. "github.com/vderyagin/dfm/testutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Aliases", func() {
+	ExecuteEachInTempDir()
+
+	var repo *Repo
+
+	BeforeEach(func() {
+		repo = New("store", "home")
+	})
+
+	stored := func(id string) string {
+		return filepath.Join(repo.Store, id)
+	}
+
+	Describe("AddAlias", func() {
+		It("creates relative symlink to target", func() {
+			CreateFile("store/bashrc")
+
+			df, err := repo.AddAlias(stored("bashrc"), filepath.Join(repo.Home, ".config/bash/profile"))
+
+			Expect(err).To(Succeed())
+			Expect(os.Readlink(stored("config/bash/profile"))).To(Equal("../../bashrc"))
+			Expect(df.IsAlias()).To(BeTrue())
+			Expect(df.AliasTarget).To(Equal(stored("bashrc")))
+		})
+
+		It("fails if target is not stored", func() {
+			_, err := repo.AddAlias(stored("bashrc"), filepath.Join(repo.Home, ".bash_profile"))
+			Expect(err).NotTo(Succeed())
+		})
+
+		It("fails if target is outside of store", func() {
+			CreateFile("bashrc")
+			target, _ := filepath.Abs("bashrc")
+
+			_, err := repo.AddAlias(target, filepath.Join(repo.Home, ".bash_profile"))
+			Expect(err).NotTo(Succeed())
+		})
+
+		It("fails if something is stored at alias location", func() {
+			CreateFile("store/bashrc")
+			CreateFile("store/bash_profile")
+
+			_, err := repo.AddAlias(stored("bashrc"), filepath.Join(repo.Home, ".bash_profile"))
+			Expect(err).NotTo(Succeed())
+		})
+	})
+
+	Describe("CheckAlias", func() {
+		It("accepts relative symlink to stored file", func() {
+			CreateFile("store/bashrc")
+			os.Symlink("bashrc", "store/bash_profile")
+
+			Expect(repo.CheckAlias(stored("bash_profile"))).To(Succeed())
+		})
+
+		It("rejects absolute symlinks", func() {
+			CreateFile("store/bashrc")
+			os.Symlink(stored("bashrc"), "store/bash_profile")
+
+			Expect(repo.CheckAlias(stored("bash_profile"))).NotTo(Succeed())
+		})
+
+		It("rejects symlinks pointing outside of store", func() {
+			CreateFile("bashrc")
+			os.Symlink("../bashrc", "store/bash_profile")
+
+			Expect(repo.CheckAlias(stored("bash_profile"))).NotTo(Succeed())
+		})
+
+		It("rejects dangling symlinks", func() {
+			CreateDir("store")
+			os.Symlink("bashrc", "store/bash_profile")
+
+			Expect(repo.CheckAlias(stored("bash_profile"))).NotTo(Succeed())
+		})
+	})
+})
@@ -0,0 +1,80 @@
+package repo
+
+import (
+	"path/filepath"
+
+	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/fsutil"
+	"github.com/vderyagin/dfm/journal"
+)
+
+// Convert turns stored dotfile df into variant to (see DotFile.Convert),
+// repointing alias symlinks to stored file that got renamed away and
+// relinking aliases of dotfile that were linked. Returns aliases that got
+// linked in the process.
+func (r *Repo) Convert(df, to *dotfile.DotFile, force bool) ([]*dotfile.DotFile, error) {
+	if l := r.Layer(df.StoredLocation); l != r {
+		return l.Convert(df, to, force)
+	}
+
+	var relinked []*dotfile.DotFile
+
+	// Remember which aliases are affected before anything changes.
+	var linked []*dotfile.DotFile
+
+	for a := range r.layerDotFiles() {
+		if a.IsAlias() && a.AliasTarget == df.StoredLocation && a.IsLinked() {
+			linked = append(linked, a)
+		}
+	}
+
+	var symlinks []string
+
+	for symlink := range fsutil.SymlinksIn(r.Store) {
+		if !fsutil.IsRelativeSymlinkWithinDir(symlink, r.Store) {
+			continue
+		}
+
+		if target, err := fsutil.ResolveSymlink(symlink); err == nil && target == df.StoredLocation {
+			symlinks = append(symlinks, symlink)
+		}
+	}
+
+	if err := df.Convert(to, force); err != nil {
+		return relinked, err
+	}
+
+	if !fsutil.Exists(df.StoredLocation) {
+		for _, symlink := range symlinks {
+			target, err := filepath.Rel(filepath.Dir(symlink), to.StoredLocation)
+
+			if err != nil {
+				return relinked, dotfile.FailErrorFrom(err)
+			}
+
+			if err := journal.ReplaceSymlink(target, symlink); err != nil {
+				return relinked, dotfile.FailErrorFrom(err)
+			}
+		}
+	}
+
+	for _, a := range linked {
+		newA := r.DotFile(a.StoredLocation)
+
+		if newA.IsLinked() {
+			continue
+		}
+
+		if err := journal.Remove(a.OriginalLocation); err != nil {
+			return relinked, dotfile.FailErrorFrom(err)
+		}
+
+		if err := newA.Link(); err != nil {
+			return relinked, err
+		}
+
+		relinked = append(relinked, newA)
+	}
+
+	return relinked, nil
+}
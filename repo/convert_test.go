@@ -0,0 +1,58 @@
+package repo_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/vderyagin/dfm/fsutil"
+	. "github.com/vderyagin/dfm/repo"
+	. "github.com/vderyagin/dfm/testutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Convert", func() {
+	ExecuteEachInTempDir()
+	ExecuteEachWithHostName("myhost")
+
+	var repo *Repo
+
+	BeforeEach(func() {
+		repo = New("store", "home")
+	})
+
+	stored := func(id string) string {
+		return filepath.Join(repo.Store, id)
+	}
+
+	home := func(path string) string {
+		return filepath.Join(repo.Home, path)
+	}
+
+	It("relinks aliases of converted file", func() {
+		CreateFile("store/bashrc")
+		os.Symlink("bashrc", stored("bash_profile"))
+		repo.DotFile(stored("bashrc")).Link()
+		repo.DotFile(stored("bash_profile")).Link()
+
+		relinked, err := repo.Convert(repo.DotFile(stored("bashrc")), repo.DotFile(stored("bashrc.host-myhost")), false)
+
+		Expect(err).To(Succeed())
+		Expect(relinked).To(HaveLen(1))
+		Expect(ResolveSymlink(home(".bash_profile"))).To(Equal(stored("bashrc.host-myhost")))
+		Expect(repo.DotFile(stored("bash_profile")).IsLinked()).To(BeTrue())
+	})
+
+	It("repoints aliases to stored file that got renamed", func() {
+		CreateFile("store/bashrc.host-myhost")
+		os.Symlink("bashrc.host-myhost", stored("bash_profile"))
+		repo.DotFile(stored("bash_profile")).Link()
+
+		_, err := repo.Convert(repo.DotFile(stored("bashrc.host-myhost")), repo.DotFile(stored("bashrc")), false)
+
+		Expect(err).To(Succeed())
+		Expect(os.Readlink(stored("bash_profile"))).To(Equal("bashrc"))
+		Expect(repo.DotFile(stored("bash_profile")).IsLinked()).To(BeTrue())
+	})
+})
@@ -0,0 +1,274 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vderyagin/dfm/fsutil"
+	"github.com/vderyagin/dfm/journal"
+)
+
+// Directives setting mode and owner of directory in home directory.
+const (
+	ModeDirective  = "mode"
+	OwnerDirective = "owner"
+)
+
+// DirSettingsError is returned for stored directory (identified by
+// store-relative id) with malformed settings.
+type DirSettingsError struct {
+	Dir, Reason string
+}
+
+func (e DirSettingsError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Dir, e.Reason)
+}
+
+// ManagedDir is a directory in home directory that dfm creates and keeps
+// with mode and owner declared in settings file of its stored counterpart.
+// Files linked into it must not be accessible to anyone directory itself is
+// not accessible to. Owner is only enforced when running as root.
+type ManagedDir struct {
+	Stored, Original string
+	Mode             os.FileMode
+	Owner            string
+}
+
+// ManagedDirs returns every directory from any of stores used on current
+// host that has mode or owner declared for it, along with DirSettingsError
+// for every directory with malformed declarations.
+func (r *Repo) ManagedDirs() ([]*ManagedDir, []error) {
+	var dirs []*ManagedDir
+	var errs []error
+
+	for _, l := range r.Layers() {
+		layerDirs, layerErrs := l.layerManagedDirs()
+		dirs = append(dirs, layerDirs...)
+		errs = append(errs, layerErrs...)
+	}
+
+	return dirs, errs
+}
+
+// layerManagedDirs returns managed directories from store of repo itself.
+func (r *Repo) layerManagedDirs() ([]*ManagedDir, []error) {
+	var dirs []*ManagedDir
+	var errs []error
+
+	filepath.Walk(r.Store, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() || path == r.Store {
+			return err
+		}
+
+		if strings.HasPrefix(fi.Name(), ".") || !r.IsActive(path) {
+			return filepath.SkipDir
+		}
+
+		md, err := r.managedDir(path)
+
+		if err != nil {
+			errs = append(errs, err)
+		} else if md != nil {
+			dirs = append(dirs, md)
+		}
+
+		return nil
+	})
+
+	return dirs, errs
+}
+
+// managedDir parses mode and owner directives of given stored directory,
+// returns nil if there are none.
+func (r *Repo) managedDir(dir string) (*ManagedDir, error) {
+	md := &ManagedDir{Stored: dir, Original: r.OriginalFilePath(dir)}
+	managed := false
+
+	fail := func(format string, args ...interface{}) (*ManagedDir, error) {
+		return nil, DirSettingsError{Dir: r.relPath(dir), Reason: fmt.Sprintf(format, args...)}
+	}
+
+	for _, directive := range r.DirDirectives(dir) {
+		fields := strings.Fields(directive)
+
+		switch fields[0] {
+		case ModeDirective:
+			if len(fields) != 2 {
+				return fail("malformed directive %q", directive)
+			}
+
+			mode, err := strconv.ParseUint(fields[1], 8, 32)
+
+			if err != nil || mode&^0777 != 0 {
+				return fail("invalid mode %q", fields[1])
+			}
+
+			md.Mode = os.FileMode(mode)
+			managed = true
+		case OwnerDirective:
+			if len(fields) != 2 {
+				return fail("malformed directive %q", directive)
+			}
+
+			md.Owner = fields[1]
+			managed = true
+		}
+	}
+
+	if !managed {
+		return nil, nil
+	}
+
+	return md, nil
+}
+
+// Contains returns true if given original location is within directory.
+func (md *ManagedDir) Contains(orig string) bool {
+	return orig != md.Original && fsutil.IsUnder(orig, md.Original)
+}
+
+// Drift describes how mode and owner of directory (if path is its location)
+// or file in it differ from declared ones. Files are followed if they are
+// symlinks.
+func (md *ManagedDir) Drift(path string) ([]string, error) {
+	var drift []string
+
+	fi, err := os.Stat(path)
+
+	if os.IsNotExist(err) && path == md.Original {
+		return []string{"missing"}, nil
+	} else if err != nil {
+		return drift, err
+	}
+
+	if mode, expected := fi.Mode().Perm(), md.expectedMode(path, fi.Mode().Perm()); mode != expected {
+		drift = append(drift, fmt.Sprintf("mode %04o, expected %04o", mode, expected))
+	}
+
+	if !md.enforcesOwner() {
+		return drift, nil
+	}
+
+	uid, gid, err := md.ids()
+
+	if err != nil {
+		return drift, err
+	}
+
+	actualUID, actualGID, err := fsutil.Owner(path)
+
+	if err != nil {
+		return drift, err
+	}
+
+	if actualUID != uid || actualGID != gid {
+		drift = append(drift, fmt.Sprintf("owner %d:%d, expected %d:%d", actualUID, actualGID, uid, gid))
+	}
+
+	return drift, nil
+}
+
+// Create creates directory with declared mode if it does not exist. Parent
+// directories are created with default mode.
+func (md *ManagedDir) Create() error {
+	if fsutil.Exists(md.Original) {
+		return nil
+	}
+
+	if err := journal.MkdirAll(filepath.Dir(md.Original), 0777); err != nil {
+		return err
+	}
+
+	return journal.MkdirAll(md.Original, md.expectedMode(md.Original, 0777))
+}
+
+// Fix changes mode and owner of directory (if path is its location) or file
+// in it to declared ones. Files are followed if they are symlinks.
+func (md *ManagedDir) Fix(path string) error {
+	fi, err := os.Stat(path)
+
+	if err != nil {
+		return err
+	}
+
+	if expected := md.expectedMode(path, fi.Mode().Perm()); fi.Mode().Perm() != expected {
+		if err := journal.Chmod(path, expected); err != nil {
+			return err
+		}
+	}
+
+	if !md.enforcesOwner() {
+		return nil
+	}
+
+	uid, gid, err := md.ids()
+
+	if err != nil {
+		return err
+	}
+
+	if actualUID, actualGID, err := fsutil.Owner(path); err != nil {
+		return err
+	} else if actualUID == uid && actualGID == gid {
+		return nil
+	}
+
+	return journal.Chown(path, uid, gid)
+}
+
+// expectedMode returns mode file at given path with given mode should have:
+// declared one for directory itself, given one without permissions for group
+// and others directory does not grant them for files in it.
+func (md *ManagedDir) expectedMode(path string, mode os.FileMode) os.FileMode {
+	if md.Mode == 0 {
+		return mode
+	}
+
+	if path == md.Original {
+		return md.Mode
+	}
+
+	return mode &^ (0077 &^ md.Mode)
+}
+
+func (md *ManagedDir) enforcesOwner() bool {
+	return md.Owner != "" && os.Geteuid() == 0
+}
+
+// ids looks up ids of declared owner, which is either "user" (primary group
+// of user is used then) or "user:group".
+func (md *ManagedDir) ids() (uid, gid int, err error) {
+	name, group, hasGroup := strings.Cut(md.Owner, ":")
+
+	u, err := user.Lookup(name)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	gidStr := u.Gid
+
+	if hasGroup {
+		g, err := user.LookupGroup(group)
+
+		if err != nil {
+			return 0, 0, err
+		}
+
+		gidStr = g.Gid
+	}
+
+	if uid, err = strconv.Atoi(u.Uid); err != nil {
+		return 0, 0, err
+	}
+
+	if gid, err = strconv.Atoi(gidStr); err != nil {
+		return 0, 0, err
+	}
+
+	return uid, gid, nil
+}
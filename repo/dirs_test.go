@@ -0,0 +1,127 @@
+package repo_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/vderyagin/dfm/dotfile"
+	. "github.com/vderyagin/dfm/repo"
+	. "github.com/vderyagin/dfm/testutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Managed directories", func() {
+	ExecuteEachInTempDir()
+	ExecuteEachWithHostName("myhost")
+
+	var repo *Repo
+
+	BeforeEach(func() {
+		repo = New("store", "home")
+	})
+
+	settings := func(id, content string) {
+		CreateFileWithContent(filepath.Join("store", id, dotfile.DirFile), []byte(content))
+	}
+
+	mode := func(path string) os.FileMode {
+		fi, err := os.Stat(path)
+		Expect(err).To(Succeed())
+		return fi.Mode().Perm()
+	}
+
+	managed := func() *ManagedDir {
+		dirs, errs := repo.ManagedDirs()
+		Expect(errs).To(BeEmpty())
+		Expect(dirs).To(HaveLen(1))
+		return dirs[0]
+	}
+
+	Describe("ManagedDirs", func() {
+		It("returns directories with declared mode or owner", func() {
+			settings("ssh", "mode 0700\nowner alice:users\n")
+			settings("config/nvim", "fold\n")
+
+			md := managed()
+			Expect(md.Original).To(Equal(filepath.Join(repo.Home, ".ssh")))
+			Expect(md.Mode).To(Equal(os.FileMode(0700)))
+			Expect(md.Owner).To(Equal("alice:users"))
+		})
+
+		It("skips directories not used on current host", func() {
+			settings("ssh.host-otherhost", "mode 0700\n")
+
+			dirs, _ := repo.ManagedDirs()
+			Expect(dirs).To(BeEmpty())
+		})
+
+		It("reports malformed declarations", func() {
+			settings("ssh", "mode rwx\n")
+
+			dirs, errs := repo.ManagedDirs()
+			Expect(dirs).To(BeEmpty())
+			Expect(errs).To(ConsistOf(DirSettingsError{Dir: "ssh", Reason: `invalid mode "rwx"`}))
+		})
+	})
+
+	Describe("Drift", func() {
+		BeforeEach(func() {
+			settings("ssh", "mode 0700\n")
+		})
+
+		It("reports missing directory", func() {
+			md := managed()
+			Expect(md.Drift(md.Original)).To(Equal([]string{"missing"}))
+		})
+
+		It("reports mode of directory different from declared one", func() {
+			md := managed()
+			CreateDir(md.Original)
+			os.Chmod(md.Original, 0755)
+
+			Expect(md.Drift(md.Original)).To(Equal([]string{"mode 0755, expected 0700"}))
+		})
+
+		It("reports files accessible to others when directory is not", func() {
+			md := managed()
+			CreateFile("store/ssh/config")
+			os.Chmod("store/ssh/config", 0644)
+			CreateDir(md.Original)
+			os.Symlink(filepath.Join(repo.Store, "ssh/config"), filepath.Join(md.Original, "config"))
+
+			Expect(md.Drift(filepath.Join(md.Original, "config"))).To(Equal([]string{"mode 0644, expected 0600"}))
+		})
+	})
+
+	Describe("Create", func() {
+		It("creates directory with declared mode", func() {
+			settings("config/secret", "mode 0700\n")
+			md := managed()
+
+			Expect(md.Create()).To(Succeed())
+			Expect(mode(md.Original)).To(Equal(os.FileMode(0700)))
+			Expect(mode(filepath.Dir(md.Original))).NotTo(Equal(os.FileMode(0700)))
+		})
+	})
+
+	Describe("Fix", func() {
+		It("fixes mode of directory and files linked into it", func() {
+			settings("ssh", "mode 0700\n")
+			md := managed()
+			CreateFile("store/ssh/config")
+			os.Chmod("store/ssh/config", 0664)
+			CreateDir(md.Original)
+			os.Chmod(md.Original, 0755)
+			config := filepath.Join(md.Original, "config")
+			os.Symlink(filepath.Join(repo.Store, "ssh/config"), config)
+
+			Expect(md.Fix(md.Original)).To(Succeed())
+			Expect(md.Fix(config)).To(Succeed())
+			Expect(mode(md.Original)).To(Equal(os.FileMode(0700)))
+			Expect(mode("store/ssh/config")).To(Equal(os.FileMode(0600)))
+			Expect(md.Drift(config)).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,168 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/fsutil"
+	"github.com/vderyagin/dfm/journal"
+	"github.com/vderyagin/dfm/variant"
+)
+
+// DirDirectives returns directives listed in settings file of given stored
+// directory, one per line. Empty lines and lines starting with "#" are
+// skipped.
+func (r *Repo) DirDirectives(dir string) []string {
+	return readPatterns(filepath.Join(dir, dotfile.DirFile))
+}
+
+// IsFolded returns true if stored directory is linked as a whole. That is
+// the case for directories marked as folded that are used on current host,
+// unless they contain variants of files (host-specific, force-copy, hard
+// linked), which require linking files one by one.
+func (r *Repo) IsFolded(dir string) bool {
+	if l := r.Layer(dir); l != r {
+		return l.IsFolded(dir)
+	}
+
+	if !fsutil.IsDir(dir) || !r.IsInStore(dir) || !r.IsActive(dir) {
+		return false
+	}
+
+	marked := false
+
+	for _, directive := range r.DirDirectives(dir) {
+		if directive == dotfile.FoldDirective {
+			marked = true
+		}
+	}
+
+	if !marked {
+		return false
+	}
+
+	hasVariants := false
+
+	filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+
+		if c, err := variant.ParseComponent(fi.Name()); err != nil || c.Host != "" || c.Copy || c.Hardlink {
+			hasVariants = true
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+
+	return !hasVariants
+}
+
+// foldedDirs returns set of locations of outermost folded directories in
+// store, directories within folded ones are not looked into.
+func (r *Repo) foldedDirs() map[string]bool {
+	folded := make(map[string]bool)
+
+	filepath.Walk(r.Store, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() || path == r.Store {
+			return err
+		}
+
+		if r.IsFolded(path) {
+			folded[path] = true
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+
+	return folded
+}
+
+// foldedDir returns location of outermost directory from given set of
+// folded ones that given stored file is in, empty string if there's none.
+func (r *Repo) foldedDir(stored string, folded map[string]bool) string {
+	dir := r.Store
+
+	for _, part := range splitPath(filepath.Dir(r.relPath(stored))) {
+		if part == "." {
+			break
+		}
+
+		dir = filepath.Join(dir, part)
+
+		if folded[dir] {
+			return dir
+		}
+	}
+
+	return ""
+}
+
+// Unfold replaces symlink to folded directory that some directory containing
+// given original location is with links to every stored file from it, one by
+// one, so that none of them is left unlinked. Returns original location of
+// directory that got unfolded (empty string if there was none) and dotfiles
+// that got linked.
+func (r *Repo) Unfold(orig string) (string, []*dotfile.DotFile, error) {
+	var linked []*dotfile.DotFile
+
+	for dir := filepath.Dir(orig); fsutil.IsUnder(dir, r.Home) && dir != r.Home; dir = filepath.Dir(dir) {
+		target, err := fsutil.ResolveSymlink(dir)
+
+		if err != nil || !r.IsInStore(target) {
+			continue
+		}
+
+		if err := journal.Remove(dir); err != nil {
+			return "", linked, err
+		}
+
+		var linkErr error
+
+		for df := range r.StoredDotFiles() {
+			if !fsutil.IsUnder(df.OriginalLocation, dir) || df.IsLinked() || linkErr != nil {
+				continue
+			}
+
+			if linkErr = df.Link(); linkErr == nil {
+				linked = append(linked, df)
+			}
+		}
+
+		return dir, linked, linkErr
+	}
+
+	return "", linked, nil
+}
+
+// Refold removes directory at original location of folded dotfile if it
+// contains nothing but links to files from it (which is what linking files
+// one by one leaves), so that it can be linked as a whole.
+func (r *Repo) Refold(df *dotfile.DotFile) error {
+	if !fsutil.IsDir(df.OriginalLocation) {
+		return nil
+	}
+
+	onlyLinks := true
+
+	filepath.Walk(df.OriginalLocation, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+
+		if target, err := fsutil.ResolveSymlink(path); err != nil || !fsutil.IsUnder(target, df.StoredLocation) {
+			onlyLinks = false
+		}
+
+		return nil
+	})
+
+	if !onlyLinks {
+		return nil
+	}
+
+	return journal.RemoveAll(df.OriginalLocation)
+}
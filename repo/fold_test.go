@@ -0,0 +1,244 @@
+package repo_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/vderyagin/dfm/dotfile"
+	. "github.com/vderyagin/dfm/fsutil"
+	"github.com/vderyagin/dfm/manifest"
+	. "github.com/vderyagin/dfm/repo"
+	. "github.com/vderyagin/dfm/testutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Folded directories", func() {
+	ExecuteEachInTempDir()
+	ExecuteEachWithHostName("myhost")
+
+	var repo *Repo
+
+	BeforeEach(func() {
+		repo = New("store", "home")
+	})
+
+	stored := func(id string) string {
+		return filepath.Join(repo.Store, id)
+	}
+
+	home := func(path string) string {
+		return filepath.Join(repo.Home, path)
+	}
+
+	fold := func(id string) {
+		CreateFileWithContent(filepath.Join("store", id, dotfile.DirFile), []byte("# comment\nfold\n"))
+	}
+
+	Describe("IsFolded", func() {
+		It("returns true for directories marked as folded", func() {
+			CreateFile("store/config/nvim/init.lua")
+			fold("config/nvim")
+
+			Expect(repo.IsFolded(stored("config/nvim"))).To(BeTrue())
+			Expect(repo.IsFolded(stored("config"))).To(BeFalse())
+		})
+
+		It("returns false for directories containing host-specific files", func() {
+			CreateFile("store/config/nvim/lua/init.lua.host-otherhost")
+			fold("config/nvim")
+
+			Expect(repo.IsFolded(stored("config/nvim"))).To(BeFalse())
+		})
+
+		It("returns false for directories containing force-copy files", func() {
+			CreateFile("store/config/nvim/init.lua.force-copy")
+			fold("config/nvim")
+
+			Expect(repo.IsFolded(stored("config/nvim"))).To(BeFalse())
+		})
+
+		It("returns false for directories not used on current host", func() {
+			CreateFile("store/config/nvim/init.lua")
+			CreateFile("store/config/nvim.host-myhost/init.lua")
+			fold("config/nvim")
+			fold("config/nvim.host-myhost")
+
+			Expect(repo.IsFolded(stored("config/nvim"))).To(BeFalse())
+			Expect(repo.IsFolded(stored("config/nvim.host-myhost"))).To(BeTrue())
+		})
+	})
+
+	Describe("StoredDotFiles", func() {
+		It("returns folded directory instead of files in it", func() {
+			CreateFile("store/config/nvim/init.lua")
+			CreateFile("store/config/nvim/lua/plugins.lua")
+			CreateFile("store/bashrc")
+			fold("config/nvim")
+
+			dotfiles := chanToSlice(repo.StoredDotFiles())
+			Expect(dotfiles).To(HaveLen(2))
+
+			for _, df := range dotfiles {
+				if df.Folded {
+					Expect(df.StoredLocation).To(Equal(stored("config/nvim")))
+					Expect(df.OriginalLocation).To(Equal(home(".config/nvim")))
+				} else {
+					Expect(df.StoredLocation).To(Equal(stored("bashrc")))
+				}
+			}
+		})
+
+		It("returns only outermost folded directory", func() {
+			CreateFile("store/config/nvim/lua/plugins.lua")
+			fold("config/nvim")
+			fold("config/nvim/lua")
+
+			dotfiles := chanToSlice(repo.StoredDotFiles())
+			Expect(dotfiles).To(HaveLen(1))
+			Expect(dotfiles[0].StoredLocation).To(Equal(stored("config/nvim")))
+		})
+
+		It("unfolds directory containing host-specific files", func() {
+			CreateFile("store/config/nvim/init.lua")
+			CreateFile("store/config/nvim/init.lua.host-myhost")
+			CreateFile("store/config/nvim/lua/plugins.lua")
+			fold("config/nvim")
+
+			var ids []string
+			for _, df := range chanToSlice(repo.StoredDotFiles()) {
+				Expect(df.Folded).To(BeFalse())
+				id, _ := filepath.Rel(repo.Store, df.StoredLocation)
+				ids = append(ids, id)
+			}
+
+			Expect(ids).To(ConsistOf("config/nvim/init.lua.host-myhost", "config/nvim/lua/plugins.lua"))
+		})
+	})
+
+	Describe("Unfold", func() {
+		It("replaces symlink to folded directory with links to every file in it", func() {
+			CreateFile("store/config/nvim/init.lua")
+			CreateFile("store/config/nvim/lua/plugins.lua")
+			CreateDir("home/.config")
+			os.Symlink(stored("config/nvim"), home(".config/nvim"))
+
+			dir, linked, err := repo.Unfold(home(".config/nvim/init.lua"))
+
+			Expect(err).To(Succeed())
+			Expect(dir).To(Equal(home(".config/nvim")))
+			Expect(linked).To(HaveLen(2))
+			Expect(IsSymlink(home(".config/nvim"))).To(BeFalse())
+			Expect(repo.DotFile(stored("config/nvim/init.lua")).IsLinked()).To(BeTrue())
+			Expect(repo.DotFile(stored("config/nvim/lua/plugins.lua")).IsLinked()).To(BeTrue())
+			Expect(IsRegularFile(stored("config/nvim/init.lua"))).To(BeTrue())
+		})
+
+		It("leaves symlinks pointing outside of store alone", func() {
+			CreateDir("elsewhere")
+			CreateDir("home/.config")
+			elsewhere, _ := filepath.Abs("elsewhere")
+			os.Symlink(elsewhere, home(".config/nvim"))
+
+			dir, _, err := repo.Unfold(home(".config/nvim/init.lua"))
+
+			Expect(err).To(Succeed())
+			Expect(dir).To(BeEmpty())
+			Expect(IsSymlink(home(".config/nvim"))).To(BeTrue())
+		})
+
+		It("leaves manifest with entries prune can rely on", func() {
+			CreateFile("store/config/nvim/init.lua")
+			CreateFile("store/config/nvim/lua/plugins.lua")
+			fold("config/nvim")
+			CreateDir("home/.config")
+
+			m, err := manifest.Load("state/manifest.json")
+			Expect(err).To(Succeed())
+
+			folded := repo.DotFile(stored("config/nvim"))
+			Expect(folded.Link()).To(Succeed())
+			m.Add(folded)
+
+			// Directory stops being folded once it has host-specific files.
+			CreateFile("store/config/nvim/local.lua.host-myhost")
+
+			dir, linked, err := repo.Unfold(home(".config/nvim/local.lua"))
+			Expect(err).To(Succeed())
+
+			m.Remove(dir)
+
+			for _, df := range linked {
+				m.Add(df)
+			}
+
+			Expect(m.Entries).NotTo(HaveKey(home(".config/nvim")))
+			Expect(m.Entries).To(HaveKey(home(".config/nvim/init.lua")))
+			Expect(m.Entries).To(HaveKey(home(".config/nvim/lua/plugins.lua")))
+
+			os.Remove(stored("config/nvim/lua/plugins.lua"))
+
+			var dotfiles []*dotfile.DotFile
+
+			for df := range repo.StoredDotFiles() {
+				dotfiles = append(dotfiles, df)
+			}
+
+			orphans := m.Orphans(repo.Store, dotfiles)
+			Expect(orphans).To(HaveLen(1))
+			Expect(orphans[0].Original).To(Equal(home(".config/nvim/lua/plugins.lua")))
+			Expect(orphans[0].IsUnmodified()).To(BeTrue())
+		})
+	})
+
+	Describe("Refold", func() {
+		It("removes links to files of folded directory", func() {
+			CreateFile("store/config/nvim/lua/init.lua")
+			fold("config/nvim")
+			CreateDir("home/.config/nvim/lua")
+			os.Symlink(stored("config/nvim/lua/init.lua"), home(".config/nvim/lua/init.lua"))
+
+			df := repo.DotFile(stored("config/nvim"))
+			Expect(repo.Refold(df)).To(Succeed())
+			Expect(Exists(home(".config/nvim"))).To(BeFalse())
+			Expect(df.Link()).To(Succeed())
+			Expect(df.IsLinked()).To(BeTrue())
+		})
+
+		It("leaves no manifest entries for removed links once folded directory is linked", func() {
+			CreateFile("store/config/nvim/init.lua")
+			CreateFile("store/config/nvim/lua/plugins.lua")
+
+			m, err := manifest.Load("state/manifest.json")
+			Expect(err).To(Succeed())
+
+			for df := range repo.StoredDotFiles() {
+				Expect(df.Link()).To(Succeed())
+				m.Add(df)
+			}
+
+			fold("config/nvim")
+
+			df := repo.DotFile(stored("config/nvim"))
+			Expect(repo.Refold(df)).To(Succeed())
+			Expect(df.Link()).To(Succeed())
+
+			m.RemoveUnder(df.OriginalLocation)
+			m.Add(df)
+
+			Expect(m.Entries).To(HaveLen(1))
+			Expect(m.Entries).To(HaveKey(home(".config/nvim")))
+			Expect(m.Orphans(repo.Store, []*dotfile.DotFile{df})).To(BeEmpty())
+		})
+
+		It("leaves directories with other files alone", func() {
+			CreateFile("store/config/nvim/init.lua")
+			fold("config/nvim")
+			CreateFile("home/.config/nvim/local.lua")
+
+			Expect(repo.Refold(repo.DotFile(stored("config/nvim")))).To(Succeed())
+			Expect(IsRegularFile(home(".config/nvim/local.lua"))).To(BeTrue())
+		})
+	})
+})
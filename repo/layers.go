@@ -0,0 +1,175 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/fsutil"
+)
+
+// RulesFile is a name of file in store root listing patterns of files in
+// home directory that get stored into that store when there are several of
+// them. Syntax is the same as that of ignore file.
+const RulesFile = ".dfmstore"
+
+// NewLayered returns a pointer to new instance of Repo with several stores,
+// listed from highest priority to lowest. Files from stores of higher
+// priority override files from stores of lower priority linked to the same
+// locations. First store is the one Repo's Store is set to.
+func NewLayered(stores []string, home string) *Repo {
+	r := New(stores[0], home)
+
+	for _, store := range stores[1:] {
+		r.lower = append(r.lower, New(store, home))
+	}
+
+	return r
+}
+
+// Layers returns repos of every store, from highest priority to lowest,
+// repo itself being the first one.
+func (r *Repo) Layers() []*Repo {
+	return append([]*Repo{r}, r.lower...)
+}
+
+// Layer returns repo of store given path is located in, repo itself if it is
+// not located in any of stores.
+func (r *Repo) Layer(path string) *Repo {
+	found := r
+
+	for _, l := range r.lower {
+		if l.inStore(path) && (!found.inStore(path) || len(l.Store) > len(found.Store)) {
+			found = l
+		}
+	}
+
+	return found
+}
+
+// LayerFor returns repo of store file at given location in home directory
+// gets stored into: the one Target is set to if any, otherwise the first
+// one with rules matching location or any directory it is in, primary one if
+// there is none.
+func (r *Repo) LayerFor(orig string) *Repo {
+	for _, l := range r.Layers() {
+		if r.Target != "" && l.Store == r.Target {
+			return l
+		}
+	}
+
+	for _, l := range r.Layers() {
+		patterns := l.Rules()
+
+		for path := orig; fsutil.IsUnder(path, r.Home) && path != r.Home; path = filepath.Dir(path) {
+			if r.matches(path, patterns) {
+				return l
+			}
+		}
+	}
+
+	return r
+}
+
+// Rules returns patterns listed in rules file of store, one per line. Empty
+// lines and lines starting with "#" are skipped.
+func (r *Repo) Rules() []string {
+	return readPatterns(filepath.Join(r.Store, RulesFile))
+}
+
+// ID returns store-relative id of file at given location in one of stores.
+func (r *Repo) ID(stored string) string {
+	l := r.Layer(stored)
+	id, _ := filepath.Rel(l.Store, stored)
+
+	return id
+}
+
+// inStore returns true if given absolute path is located within store of
+// repo itself, not taking other layers into account.
+func (r *Repo) inStore(path string) bool {
+	return path != r.Store && fsutil.IsUnder(path, r.Store)
+}
+
+// taken keeps track of locations dotfiles from stores of higher priority are
+// linked to: original locations themselves, ones of folded directories and
+// directories containing any of them.
+type taken struct {
+	originals map[string]bool
+	folded    map[string]bool
+	parents   map[string]bool
+}
+
+func newTaken() *taken {
+	return &taken{
+		originals: make(map[string]bool),
+		folded:    make(map[string]bool),
+		parents:   make(map[string]bool),
+	}
+}
+
+// add marks location of given dotfile as taken.
+func (t *taken) add(df *dotfile.DotFile) {
+	t.originals[df.OriginalLocation] = true
+
+	if df.Folded {
+		t.folded[df.OriginalLocation] = true
+	}
+
+	for dir := filepath.Dir(df.OriginalLocation); !t.parents[dir]; dir = filepath.Dir(dir) {
+		t.parents[dir] = true
+
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+}
+
+// overrides returns true if some dotfile from store of higher priority takes
+// place of given dotfile from store of lower priority: either they are
+// linked to the same location, or one of them is folded directory the other
+// would be linked into.
+func (t *taken) overrides(lower *dotfile.DotFile) bool {
+	if t.originals[lower.OriginalLocation] {
+		return true
+	}
+
+	if lower.Folded && t.parents[lower.OriginalLocation] {
+		return true
+	}
+
+	for dir := filepath.Dir(lower.OriginalLocation); ; dir = filepath.Dir(dir) {
+		if t.folded[dir] {
+			return true
+		}
+
+		if dir == filepath.Dir(dir) {
+			return false
+		}
+	}
+}
+
+// readPatterns returns patterns listed in given file, one per line. Empty
+// lines and lines starting with "#" are skipped.
+func readPatterns(file string) []string {
+	var patterns []string
+
+	content, err := os.ReadFile(file)
+
+	if err != nil {
+		return patterns
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		patterns = append(patterns, line)
+	}
+
+	return patterns
+}
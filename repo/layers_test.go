@@ -0,0 +1,134 @@
+package repo_test
+
+import (
+	"path/filepath"
+
+	"github.com/vderyagin/dfm/dotfile"
+	. "github.com/vderyagin/dfm/repo"
+	. "github.com/vderyagin/dfm/testutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Layers", func() {
+	ExecuteEachInTempDir()
+
+	var repo *Repo
+
+	BeforeEach(func() {
+		repo = NewLayered([]string{"personal", "team"}, "home")
+	})
+
+	personal := func(id string) string {
+		p, _ := filepath.Abs(filepath.Join("personal", id))
+		return p
+	}
+
+	team := func(id string) string {
+		p, _ := filepath.Abs(filepath.Join("team", id))
+		return p
+	}
+
+	home := func(path string) string {
+		return filepath.Join(repo.Home, path)
+	}
+
+	stored := func() map[string]string {
+		result := make(map[string]string)
+
+		for df := range repo.StoredDotFiles() {
+			result[df.OriginalLocation] = df.StoredLocation
+		}
+
+		return result
+	}
+
+	Describe("StoredDotFiles", func() {
+		It("merges dotfiles from every store", func() {
+			CreateFile("personal/zshrc")
+			CreateFile("team/gitconfig")
+
+			Expect(stored()).To(Equal(map[string]string{
+				home(".zshrc"):     personal("zshrc"),
+				home(".gitconfig"): team("gitconfig"),
+			}))
+		})
+
+		It("prefers dotfiles from stores of higher priority", func() {
+			CreateFile("personal/bashrc")
+			CreateFile("team/bashrc")
+
+			Expect(stored()).To(Equal(map[string]string{
+				home(".bashrc"): personal("bashrc"),
+			}))
+		})
+
+		It("does not link files into folded directories of other stores", func() {
+			CreateFileWithContent(filepath.Join("team/vim", dotfile.DirFile), []byte("fold\n"))
+			CreateFile("team/vim/vimrc")
+			CreateFile("personal/vim/colors/dark.vim")
+
+			Expect(stored()).To(Equal(map[string]string{
+				home(".vim/colors/dark.vim"): personal("vim/colors/dark.vim"),
+			}))
+		})
+
+		It("does not link files of other stores into folded directories", func() {
+			CreateFileWithContent(filepath.Join("personal/vim", dotfile.DirFile), []byte("fold\n"))
+			CreateFile("personal/vim/vimrc")
+			CreateFile("team/vim/colors/dark.vim")
+			CreateFile("team/vimrc")
+
+			Expect(stored()).To(Equal(map[string]string{
+				home(".vim"):   personal("vim"),
+				home(".vimrc"): team("vimrc"),
+			}))
+		})
+	})
+
+	Describe("Layer", func() {
+		It("returns repo of store path is in", func() {
+			Expect(repo.Layer(team("bashrc")).Store).To(Equal(team("")))
+			Expect(repo.Layer(personal("bashrc"))).To(BeIdenticalTo(repo))
+			Expect(repo.Layer(home(".bashrc"))).To(BeIdenticalTo(repo))
+		})
+
+		It("identifies stored files relative to their stores", func() {
+			Expect(repo.IsInStore(team("bashrc"))).To(BeTrue())
+			Expect(repo.ID(team("config/git"))).To(Equal("config/git"))
+		})
+
+		It("resolves ids to files from stores of higher priority first", func() {
+			CreateFile("team/bashrc")
+			CreateFile("team/zshrc")
+			CreateFile("personal/zshrc")
+
+			Expect(repo.ResolvePath("bashrc")).To(Equal(team("bashrc")))
+			Expect(repo.ResolvePath("zshrc")).To(Equal(personal("zshrc")))
+		})
+	})
+
+	Describe("LayerFor", func() {
+		It("returns the first store with matching rules", func() {
+			CreateFileWithContent(filepath.Join("team", RulesFile), []byte("# shared\n.config/git\n*.team\n"))
+
+			Expect(repo.LayerFor(home(".config/git/config")).Store).To(Equal(team("")))
+			Expect(repo.LayerFor(home(".foo.team")).Store).To(Equal(team("")))
+			Expect(repo.LayerFor(home(".config/nvim/init.lua"))).To(BeIdenticalTo(repo))
+		})
+
+		It("returns target store if one is set", func() {
+			repo.Target = team("")
+
+			Expect(repo.LayerFor(home(".bashrc")).Store).To(Equal(team("")))
+		})
+
+		It("determines where files get stored", func() {
+			CreateFileWithContent(filepath.Join("team", RulesFile), []byte(".gitconfig\n"))
+
+			Expect(repo.StoredFilePath(home(".gitconfig"), false, false)).To(Equal(team("gitconfig")))
+			Expect(repo.StoredFilePath(home(".bashrc"), false, false)).To(Equal(personal("bashrc")))
+		})
+	})
+})
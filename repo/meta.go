@@ -0,0 +1,116 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/variant"
+)
+
+// MetaFile is a name of file in store root mapping ids of stored files to
+// their attributes.
+const MetaFile = ".dfm.json"
+
+// Meta holds attributes of stored file: mode it should have, link style,
+// description, tags and application it belongs to.
+type Meta struct {
+	Mode        string   `json:"mode,omitempty"`
+	Style       string   `json:"style,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	App         string   `json:"app,omitempty"`
+}
+
+// FileMode returns declared mode, zero if it is not declared.
+func (m Meta) FileMode() (os.FileMode, error) {
+	if m.Mode == "" {
+		return 0, nil
+	}
+
+	mode, err := strconv.ParseUint(m.Mode, 8, 32)
+
+	if err != nil || mode == 0 || mode&^0777 != 0 {
+		return 0, fmt.Errorf("invalid mode %q", m.Mode)
+	}
+
+	return os.FileMode(mode), nil
+}
+
+func (m Meta) validate() error {
+	if _, err := m.FileMode(); err != nil {
+		return err
+	}
+
+	switch m.Style {
+	case "", dotfile.StyleSymlink, dotfile.StyleAbsolute, dotfile.StyleRelative,
+		dotfile.StyleCopy, dotfile.StyleHardlink:
+		return nil
+	}
+
+	return fmt.Errorf("unknown style %q", m.Style)
+}
+
+// Metadata returns attributes of stored files, keyed by ids of stored files.
+// Missing metadata file is treated as empty one. Metadata is read once.
+func (r *Repo) Metadata() (map[string]Meta, error) {
+	r.metaOnce.Do(func() {
+		r.meta, r.metaErr = r.loadMetadata()
+	})
+
+	return r.meta, r.metaErr
+}
+
+func (r *Repo) loadMetadata() (map[string]Meta, error) {
+	meta := make(map[string]Meta)
+
+	content, err := os.ReadFile(filepath.Join(r.Store, MetaFile))
+
+	if os.IsNotExist(err) {
+		return meta, nil
+	} else if err != nil {
+		return meta, err
+	}
+
+	if err := json.Unmarshal(content, &meta); err != nil {
+		return make(map[string]Meta), err
+	}
+
+	for id, m := range meta {
+		if err := m.validate(); err != nil {
+			return make(map[string]Meta), fmt.Errorf("%s: %s", id, err)
+		}
+	}
+
+	return meta, nil
+}
+
+// Meta returns attributes of stored file at given location. Attributes
+// listed for its id are used, or, if there are none, those listed for id of
+// its generic variant. Malformed metadata is ignored.
+func (r *Repo) Meta(stored string) Meta {
+	if l := r.Layer(stored); l != r {
+		return l.Meta(stored)
+	}
+
+	meta, _ := r.Metadata()
+
+	if !r.IsInStore(stored) {
+		return Meta{}
+	}
+
+	id := r.relPath(stored)
+
+	if m, ok := meta[id]; ok {
+		return m
+	}
+
+	if v, err := variant.Parse(id); err == nil {
+		return meta[v.Base()]
+	}
+
+	return Meta{}
+}
@@ -0,0 +1,87 @@
+package repo_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/vderyagin/dfm/dotfile"
+	. "github.com/vderyagin/dfm/repo"
+	. "github.com/vderyagin/dfm/testutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metadata", func() {
+	ExecuteEachInTempDir()
+
+	var repo *Repo
+
+	BeforeEach(func() {
+		repo = New("store", "home")
+	})
+
+	stored := func(id string) string {
+		return filepath.Join(repo.Store, id)
+	}
+
+	metadata := func(content string) {
+		CreateFileWithContent(filepath.Join("store", MetaFile), []byte(content))
+	}
+
+	It("is empty if there's no metadata file", func() {
+		Expect(repo.Metadata()).To(BeEmpty())
+		Expect(repo.Meta(stored("bashrc"))).To(Equal(Meta{}))
+	})
+
+	It("returns attributes listed for id of stored file", func() {
+		metadata(`{"bashrc": {"mode": "0600", "description": "shell", "tags": ["sh"], "app": "bash"}}`)
+
+		Expect(repo.Meta(stored("bashrc"))).To(Equal(Meta{
+			Mode:        "0600",
+			Description: "shell",
+			Tags:        []string{"sh"},
+			App:         "bash",
+		}))
+	})
+
+	It("falls back to attributes of generic variant", func() {
+		metadata(`{"bashrc": {"app": "bash"}, "zshrc.host-foo": {"app": "zsh"}}`)
+
+		Expect(repo.Meta(stored("bashrc.host-foo")).App).To(Equal("bash"))
+		Expect(repo.Meta(stored("zshrc")).App).To(BeEmpty())
+	})
+
+	It("rejects invalid attributes", func() {
+		metadata(`{"bashrc": {"style": "telepathy"}}`)
+
+		_, err := repo.Metadata()
+		Expect(err).NotTo(Succeed())
+		Expect(repo.Meta(stored("bashrc"))).To(Equal(Meta{}))
+
+		metadata(`{"bashrc": {"mode": "rw"}}`)
+
+		_, err = New("store", "home").Metadata()
+		Expect(err).NotTo(Succeed())
+	})
+
+	It("applies default link style to dotfiles without declared one", func() {
+		CreateFile("store/bashrc")
+		CreateFile("store/zshrc")
+		metadata(`{"zshrc": {"style": "absolute"}}`)
+		repo.LinkStyle = dotfile.StyleRelative
+
+		Expect(repo.DotFile(stored("bashrc")).Style).To(Equal(dotfile.StyleRelative))
+		Expect(repo.DotFile(stored("zshrc")).Style).To(Equal(dotfile.StyleAbsolute))
+	})
+
+	It("applies attributes to dotfiles", func() {
+		CreateFile("store/gitconfig")
+		metadata(`{"gitconfig": {"mode": "0640", "style": "copy"}}`)
+
+		df := repo.DotFile(stored("gitconfig"))
+		Expect(df.Mode).To(Equal(os.FileMode(0640)))
+		Expect(df.Style).To(Equal(dotfile.StyleCopy))
+		Expect(df.MustBeCopied()).To(BeTrue())
+	})
+})
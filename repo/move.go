@@ -0,0 +1,235 @@
+package repo
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/fsutil"
+	"github.com/vderyagin/dfm/journal"
+)
+
+// Variants returns sorted locations of every stored variant (generic,
+// host-specific for any host, force-copy) of dotfile with given original
+// location in any of stores, alias symlinks included.
+func (r *Repo) Variants(orig string) []string {
+	var variants []string
+
+	for _, l := range r.Layers() {
+		variants = append(variants, l.variants(orig)...)
+	}
+
+	sort.Strings(variants)
+
+	return variants
+}
+
+// variants returns sorted locations of every stored variant of dotfile with
+// given original location in store of repo itself.
+func (r *Repo) variants(orig string) []string {
+	var variants []string
+
+	base, err := r.genericStoredFilePath(orig)
+
+	if err != nil {
+		return variants
+	}
+
+	collect := func(paths <-chan string) {
+		for path := range paths {
+			if strings.HasPrefix(path, base) && r.OriginalFilePath(path) == orig {
+				variants = append(variants, path)
+			}
+		}
+	}
+
+	collect(fsutil.FilesIn(filepath.Dir(base)))
+	collect(fsutil.SymlinksIn(filepath.Dir(base)))
+
+	sort.Strings(variants)
+
+	return variants
+}
+
+// dirVariant returns location of some variant of dotfile with given original
+// location in store of repo itself that is in a directory with suffixes
+// (like "config.host-foo/bar"), which variants does not find, or empty
+// string if there is none.
+func (r *Repo) dirVariant(orig string, variants []string) string {
+	found := ""
+	known := make(map[string]bool)
+
+	for _, v := range variants {
+		known[v] = true
+	}
+
+	for _, paths := range []<-chan string{fsutil.FilesIn(r.Store), fsutil.SymlinksIn(r.Store)} {
+		for path := range paths {
+			if found == "" && !known[path] && r.OriginalFilePath(path) == orig {
+				found = path
+			}
+		}
+	}
+
+	return found
+}
+
+type alias struct{ location, target string }
+
+// Move makes dotfile with original location oldOrig have original location
+// newOrig: every variant of it is moved within store, alias symlinks pointing
+// to moved files are updated, and links in home directory are recreated.
+// Returns dotfiles that got linked in the process. Dotfile is moved within
+// store of highest priority it is stored in.
+func (r *Repo) Move(oldOrig, newOrig string) ([]*dotfile.DotFile, error) {
+	var relinked []*dotfile.DotFile
+
+	for _, l := range r.lower {
+		if len(r.variants(oldOrig)) == 0 && len(l.variants(oldOrig)) > 0 {
+			return l.Move(oldOrig, newOrig)
+		}
+	}
+
+	oldBase, err := r.genericStoredFilePath(oldOrig)
+
+	if err != nil {
+		return relinked, err
+	}
+
+	newBase, err := r.genericStoredFilePath(newOrig)
+
+	if err != nil {
+		return relinked, err
+	}
+
+	variants := r.variants(oldOrig)
+
+	if len(variants) == 0 {
+		return relinked, fmt.Errorf("%s is not stored", oldOrig)
+	}
+
+	if len(r.Variants(newOrig)) > 0 {
+		return relinked, fmt.Errorf("%s is stored already", newOrig)
+	}
+
+	// Suffixes of directories would have to be carried over to new location,
+	// which is better done by hand.
+	if v := r.dirVariant(oldOrig, variants); v != "" {
+		return relinked, fmt.Errorf("%s is in directory specific to some host or variant, move it by hand", v)
+	}
+
+	moves := make(map[string]string)
+
+	for _, v := range variants {
+		moves[v] = newBase + strings.TrimPrefix(v, oldBase)
+	}
+
+	// Aliases can point to generic name of file that only has other
+	// variants.
+	if _, ok := moves[oldBase]; !ok {
+		moves[oldBase] = newBase
+	}
+
+	moved := func(path string) string {
+		if newPath, ok := moves[path]; ok {
+			return newPath
+		}
+		return path
+	}
+
+	// Remember what is linked and which aliases are affected before
+	// anything changes.
+	var linked []*dotfile.DotFile
+
+	for df := range r.StoredDotFiles() {
+		if (moved(df.StoredLocation) != df.StoredLocation || moved(df.AliasTarget) != df.AliasTarget) && df.IsLinked() {
+			linked = append(linked, df)
+		}
+	}
+
+	var aliases []alias
+
+	for symlink := range fsutil.SymlinksIn(r.Store) {
+		if !fsutil.IsRelativeSymlinkWithinDir(symlink, r.Store) {
+			continue
+		}
+
+		target, err := fsutil.ResolveSymlink(symlink)
+
+		if err != nil {
+			continue
+		}
+
+		if moved(symlink) != symlink || moved(target) != target {
+			aliases = append(aliases, alias{symlink, target})
+		}
+	}
+
+	// Make sure nothing is in the way before changing anything, so that
+	// move is not left half-done.
+	for _, v := range variants {
+		if !fsutil.CanCreate(moves[v]) {
+			return relinked, fmt.Errorf("can not create %s", moves[v])
+		}
+	}
+
+	for _, df := range linked {
+		if orig := r.OriginalFilePath(moved(df.StoredLocation)); orig != df.OriginalLocation && !fsutil.CanCreate(orig) {
+			return relinked, fmt.Errorf("can not link %s, something is in the way", orig)
+		}
+	}
+
+	for _, v := range variants {
+		if err := journal.MkdirAll(filepath.Dir(moves[v]), 0777); err != nil {
+			return relinked, err
+		}
+
+		if err := journal.Rename(v, moves[v]); err != nil {
+			return relinked, err
+		}
+
+		if err := journal.DeleteEmptyDirs(filepath.Dir(v)); err != nil {
+			return relinked, err
+		}
+	}
+
+	for _, a := range aliases {
+		location := moved(a.location)
+		target, err := filepath.Rel(filepath.Dir(location), moved(a.target))
+
+		if err != nil {
+			return relinked, err
+		}
+
+		if err := journal.ReplaceSymlink(target, location); err != nil {
+			return relinked, err
+		}
+	}
+
+	// Links are made anew rather than repointed, for copies and hard links
+	// to stay such.
+	for _, df := range linked {
+		newDf := r.DotFile(moved(df.StoredLocation))
+
+		if err := journal.Remove(df.OriginalLocation); err != nil {
+			return relinked, err
+		}
+
+		// Only alias target moved if original location is the same.
+		if newDf.OriginalLocation != df.OriginalLocation {
+			if err := journal.DeleteEmptyDirs(filepath.Dir(df.OriginalLocation)); err != nil {
+				return relinked, err
+			}
+		}
+
+		if err := newDf.Link(); err != nil {
+			return relinked, err
+		}
+
+		relinked = append(relinked, newDf)
+	}
+
+	return relinked, nil
+}
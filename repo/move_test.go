@@ -0,0 +1,149 @@
+package repo_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/vderyagin/dfm/fsutil"
+	. "github.com/vderyagin/dfm/repo"
+	. "github.com/vderyagin/dfm/testutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Move", func() {
+	ExecuteEachInTempDir()
+	ExecuteEachWithHostName("myhost")
+
+	var repo *Repo
+
+	BeforeEach(func() {
+		repo = New("store", "home")
+	})
+
+	stored := func(id string) string {
+		return filepath.Join(repo.Store, id)
+	}
+
+	home := func(path string) string {
+		return filepath.Join(repo.Home, path)
+	}
+
+	Describe("Variants", func() {
+		It("returns every variant of dotfile", func() {
+			CreateFile("store/foorc")
+			CreateFile("store/foorc.host-myhost")
+			CreateFile("store/foorc.host-otherhost.force-copy")
+			CreateFile("store/foorcx")
+
+			Expect(repo.Variants(home(".foorc"))).To(Equal([]string{
+				stored("foorc"),
+				stored("foorc.host-myhost"),
+				stored("foorc.host-otherhost.force-copy"),
+			}))
+		})
+
+		It("returns empty list if dotfile is not stored", func() {
+			Expect(repo.Variants(home(".foorc"))).To(BeEmpty())
+		})
+	})
+
+	It("moves every variant within store", func() {
+		CreateFile("store/foorc")
+		CreateFile("store/foorc.host-otherhost.force-copy")
+
+		_, err := repo.Move(home(".foorc"), home(".config/foo/config"))
+
+		Expect(err).To(Succeed())
+		Expect(IsRegularFile(stored("config/foo/config"))).To(BeTrue())
+		Expect(IsRegularFile(stored("config/foo/config.host-otherhost.force-copy"))).To(BeTrue())
+		Expect(Exists(stored("foorc"))).To(BeFalse())
+	})
+
+	It("relinks linked dotfile", func() {
+		CreateFile("store/foorc.host-myhost")
+		repo.DotFile(stored("foorc.host-myhost")).Link()
+
+		relinked, err := repo.Move(home(".foorc"), home(".config/foo/config"))
+
+		Expect(err).To(Succeed())
+		Expect(relinked).To(HaveLen(1))
+		Expect(relinked[0].IsLinked()).To(BeTrue())
+		Expect(relinked[0].OriginalLocation).To(Equal(home(".config/foo/config")))
+		Expect(Exists(home(".foorc"))).To(BeFalse())
+	})
+
+	It("updates aliases pointing to moved file", func() {
+		CreateFile("store/foorc")
+		os.Symlink("foorc", "store/alias")
+		repo.DotFile(stored("alias")).Link()
+
+		_, err := repo.Move(home(".foorc"), home(".config/foo/config"))
+
+		Expect(err).To(Succeed())
+		Expect(os.Readlink(stored("alias"))).To(Equal("config/foo/config"))
+		Expect(repo.DotFile(stored("alias")).IsLinked()).To(BeTrue())
+	})
+
+	It("keeps copies of aliases pointing to moved file copies", func() {
+		CreateFile("store/foorc.force-copy")
+		os.Symlink("foorc", "store/alias")
+		repo.DotFile(stored("alias")).Link()
+
+		_, err := repo.Move(home(".foorc"), home(".config/foo/config"))
+
+		Expect(err).To(Succeed())
+		Expect(IsRegularFile(home(".alias"))).To(BeTrue())
+		Expect(repo.DotFile(stored("alias")).IsLinked()).To(BeTrue())
+	})
+
+	It("fails without changing anything if dotfile has variants in directories with suffixes", func() {
+		CreateFile("store/config/foo")
+		CreateFile("store/config.host-otherhost/foo")
+
+		_, err := repo.Move(home(".config/foo"), home(".config/bar"))
+
+		Expect(err).NotTo(Succeed())
+		Expect(IsRegularFile(stored("config/foo"))).To(BeTrue())
+		Expect(IsRegularFile(stored("config.host-otherhost/foo"))).To(BeTrue())
+	})
+
+	It("updates relative target of moved alias", func() {
+		CreateFile("store/foorc")
+		os.Symlink("foorc", "store/alias")
+
+		_, err := repo.Move(home(".alias"), home(".config/alias"))
+
+		Expect(err).To(Succeed())
+		Expect(os.Readlink(stored("config/alias"))).To(Equal("../foorc"))
+	})
+
+	It("changes nothing if something is in the way in home directory", func() {
+		CreateFile("store/foorc")
+		repo.DotFile(stored("foorc")).Link()
+		CreateFile("home/.barrc")
+
+		_, err := repo.Move(home(".foorc"), home(".barrc"))
+
+		Expect(err).NotTo(Succeed())
+		Expect(IsRegularFile(stored("foorc"))).To(BeTrue())
+		Expect(Exists(stored("barrc"))).To(BeFalse())
+		Expect(repo.DotFile(stored("foorc")).IsLinked()).To(BeTrue())
+	})
+
+	It("fails if dotfile is not stored", func() {
+		_, err := repo.Move(home(".foorc"), home(".barrc"))
+		Expect(err).NotTo(Succeed())
+	})
+
+	It("fails if there are stored files at new location", func() {
+		CreateFile("store/foorc")
+		CreateFile("store/barrc.host-otherhost")
+
+		_, err := repo.Move(home(".foorc"), home(".barrc"))
+
+		Expect(err).NotTo(Succeed())
+		Expect(Exists(stored("foorc"))).To(BeTrue())
+	})
+})
@@ -0,0 +1,104 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vderyagin/dfm/dotfile"
+	"github.com/vderyagin/dfm/fsutil"
+	"github.com/vderyagin/dfm/journal"
+)
+
+// pointsInto returns true if symlink at given location points to something
+// within given directory.
+func pointsInto(link, dir string) bool {
+	target, err := fsutil.ResolveSymlink(link)
+	return err == nil && target != dir && fsutil.IsUnder(target, dir)
+}
+
+// FormerStores guesses where stores used to be located before they were
+// moved, judging by symlinks to stored files in home directory that point to
+// files with the same store-relative paths outside of every current store.
+// Returns former locations keyed by current ones, stores there are no such
+// symlinks for are left out.
+func (r *Repo) FormerStores() map[string]string {
+	votes := make(map[string]map[string]int)
+	former := make(map[string]string)
+
+	for df := range r.StoredDotFiles() {
+		target, err := fsutil.ResolveSymlink(df.OriginalLocation)
+
+		if err != nil || r.IsInStore(target) {
+			continue
+		}
+
+		l := r.Layer(df.StoredLocation)
+		suffix := string(filepath.Separator) + l.relPath(storedFile(df))
+
+		if !strings.HasSuffix(target, suffix) {
+			continue
+		}
+
+		if votes[l.Store] == nil {
+			votes[l.Store] = make(map[string]int)
+		}
+
+		guess := strings.TrimSuffix(target, suffix)
+		votes[l.Store][guess]++
+
+		if best, ok := former[l.Store]; !ok || votes[l.Store][guess] > votes[l.Store][best] {
+			former[l.Store] = guess
+		}
+	}
+
+	return former
+}
+
+// Relocate repoints symlink at given location in home directory from file in
+// store formerly located at oldStore to the same file in current store,
+// keeping symlink absolute or relative. Returns new location of file symlink
+// points to. Returns dotfile.SkipError if symlink does not point into former
+// store.
+func (r *Repo) Relocate(link, oldStore string) (string, error) {
+	if !pointsInto(link, oldStore) {
+		return "", dotfile.SkipError(fmt.Sprintf("does not point into %s", oldStore))
+	}
+
+	target, _ := fsutil.ResolveSymlink(link)
+	relPath, err := filepath.Rel(oldStore, target)
+
+	if err != nil {
+		return "", err
+	}
+
+	newTarget := filepath.Join(r.Store, relPath)
+
+	if !fsutil.Exists(newTarget) {
+		return "", fmt.Errorf("%s is not in store", relPath)
+	}
+
+	content := newTarget
+
+	if raw, err := os.Readlink(link); err == nil && !filepath.IsAbs(raw) {
+		if content, err = filepath.Rel(filepath.Dir(link), newTarget); err != nil {
+			return "", err
+		}
+	}
+
+	if err := journal.ReplaceSymlink(content, link); err != nil {
+		return "", err
+	}
+
+	return newTarget, nil
+}
+
+// storedFile returns location of file dotfile gets linked to.
+func storedFile(df *dotfile.DotFile) string {
+	if df.IsAlias() {
+		return df.AliasTarget
+	}
+
+	return df.StoredLocation
+}
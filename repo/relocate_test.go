@@ -0,0 +1,117 @@
+package repo_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/vderyagin/dfm/dotfile"
+	. "github.com/vderyagin/dfm/repo"
+	. "github.com/vderyagin/dfm/testutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Relocate", func() {
+	ExecuteEachInTempDir()
+	ExecuteEachWithHostName("myhost")
+
+	var repo *Repo
+	var oldStore string
+
+	BeforeEach(func() {
+		repo = New("store", "home")
+		oldStore, _ = filepath.Abs("old-store")
+		CreateDir("home")
+	})
+
+	stored := func(id string) string {
+		return filepath.Join(repo.Store, id)
+	}
+
+	home := func(path string) string {
+		return filepath.Join(repo.Home, path)
+	}
+
+	Describe("Relocate", func() {
+		It("repoints absolute symlinks to current store", func() {
+			CreateFile("store/bashrc")
+			os.Symlink(filepath.Join(oldStore, "bashrc"), home(".bashrc"))
+
+			target, err := repo.Relocate(home(".bashrc"), oldStore)
+
+			Expect(err).To(Succeed())
+			Expect(target).To(Equal(stored("bashrc")))
+			Expect(os.Readlink(home(".bashrc"))).To(Equal(stored("bashrc")))
+		})
+
+		It("keeps relative symlinks relative", func() {
+			CreateFile("store/bashrc.host-myhost")
+			os.Symlink("../old-store/bashrc.host-myhost", home(".bashrc"))
+
+			_, err := repo.Relocate(home(".bashrc"), oldStore)
+
+			Expect(err).To(Succeed())
+			Expect(os.Readlink(home(".bashrc"))).To(Equal("../store/bashrc.host-myhost"))
+		})
+
+		It("skips symlinks not pointing into former store", func() {
+			CreateFile("store/bashrc")
+			os.Symlink(stored("bashrc"), home(".bashrc"))
+
+			_, err := repo.Relocate(home(".bashrc"), oldStore)
+
+			Expect(err).To(BeAssignableToTypeOf(dotfile.SkipError("")))
+			Expect(os.Readlink(home(".bashrc"))).To(Equal(stored("bashrc")))
+		})
+
+		It("fails if file is missing from current store", func() {
+			os.Symlink(filepath.Join(oldStore, "bashrc"), home(".bashrc"))
+
+			_, err := repo.Relocate(home(".bashrc"), oldStore)
+
+			Expect(err).NotTo(Succeed())
+			Expect(os.Readlink(home(".bashrc"))).To(Equal(filepath.Join(oldStore, "bashrc")))
+		})
+	})
+
+	Describe("FormerStore", func() {
+		It("is guessed from symlinks to stored files", func() {
+			CreateFile("store/bashrc")
+			CreateFile("store/zshrc.host-myhost")
+			os.Symlink(filepath.Join(oldStore, "bashrc"), home(".bashrc"))
+			os.Symlink(filepath.Join(oldStore, "zshrc.host-myhost"), home(".zshrc"))
+
+			Expect(repo.FormerStores()).To(Equal(map[string]string{repo.Store: oldStore}))
+		})
+
+		It("takes aliases into account", func() {
+			CreateFile("store/bashrc")
+			os.Symlink("bashrc", "store/bash_profile")
+			os.Symlink(filepath.Join(oldStore, "bashrc"), home(".bash_profile"))
+
+			Expect(repo.FormerStores()).To(Equal(map[string]string{repo.Store: oldStore}))
+		})
+
+		It("is empty if everything is linked to current store", func() {
+			CreateFile("store/bashrc")
+			os.Symlink(stored("bashrc"), home(".bashrc"))
+
+			Expect(repo.FormerStores()).To(BeEmpty())
+		})
+
+		It("does not take symlinks into other current stores for evidence", func() {
+			repo = NewLayered([]string{"work", "store"}, "home")
+			work, _ := filepath.Abs("work")
+			store, _ := filepath.Abs("store")
+
+			CreateFile("work/vimrc")
+			CreateFile("store/bashrc")
+			CreateFile("store/zshrc")
+			os.Symlink(filepath.Join(work, "bashrc"), home(".bashrc"))
+			os.Symlink(filepath.Join(oldStore, "zshrc"), home(".zshrc"))
+
+			Expect(repo.FormerStores()).To(Equal(map[string]string{store: oldStore}))
+		})
+	})
+})
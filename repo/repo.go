@@ -5,16 +5,35 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/vderyagin/dfm/dotfile"
 	"github.com/vderyagin/dfm/fsutil"
 	"github.com/vderyagin/dfm/host"
+	"github.com/vderyagin/dfm/variant"
 )
 
-// Repo represents a place where dotfiles are stored.
-type Repo struct{ Store, Home string }
+// IgnoreFile is a name of file in store root listing patterns of files that
+// should not be stored when storing whole directories.
+const IgnoreFile = ".dfmignore"
+
+// Repo represents a place where dotfiles are stored. LinkStyle is default
+// form of symlinks to stored files, absolute unless set to
+// dotfile.StyleRelative. Repo may have several stores layered on top of each
+// other (see NewLayered), Target is the one files get stored into regardless
+// of rules of stores when set.
+type Repo struct {
+	Store, Home string
+	LinkStyle   string
+	Target      string
+
+	lower []*Repo
+
+	metaOnce sync.Once
+	meta     map[string]Meta
+	metaErr  error
+}
 
 // New returns a pointer to new instance of Repo. Makes sure that paths Repo
 // initialized with are absolute, fails loudly if they are not absolute and
@@ -38,44 +57,68 @@ func New(store, home string) *Repo {
 }
 
 // StoredDotFiles returns a channel producing DotFile objects for every stored
-// dotfile, including alias symlinks.
+// dotfile, including alias symlinks and folded directories (instead of files
+// in them). Dotfiles from all stores are produced, except for ones overridden
+// by dotfiles from stores of higher priority.
 func (r *Repo) StoredDotFiles() <-chan *dotfile.DotFile {
 	dotFileChan := make(chan *dotfile.DotFile)
 
 	go func(c chan<- *dotfile.DotFile) {
-		for file := range fsutil.FilesIn(r.Store) {
-			df := dotfile.DotFile{
-				StoredLocation:   file,
-				OriginalLocation: r.OriginalFilePath(file),
-			}
+		taken := newTaken()
+
+		for _, l := range r.Layers() {
+			var produced []*dotfile.DotFile
 
-			noConflict := df.IsGeneric() && !fsutil.Exists(df.StoredLocation+host.DotFileLocalSuffix())
+			for df := range l.layerDotFiles() {
+				if taken.overrides(df) {
+					continue
+				}
 
-			if df.IsFromThisHost() || noConflict {
-				c <- &df
+				produced = append(produced, df)
+				c <- df
 			}
-		}
 
-		for symlink := range fsutil.SymlinksIn(r.Store) {
-			if !fsutil.IsRelativeSymlinkWithinDir(symlink, r.Store) {
-				continue
+			for _, df := range produced {
+				taken.add(df)
 			}
+		}
 
-			aliasTarget, err := fsutil.ResolveSymlink(symlink)
-			if err != nil {
+		close(c)
+	}(dotFileChan)
+
+	return dotFileChan
+}
+
+// layerDotFiles returns a channel producing DotFile objects for every
+// dotfile from store of repo itself.
+func (r *Repo) layerDotFiles() <-chan *dotfile.DotFile {
+	dotFileChan := make(chan *dotfile.DotFile)
+
+	go func(c chan<- *dotfile.DotFile) {
+		folded := r.foldedDirs()
+		seen := make(map[string]bool)
+
+		for file := range fsutil.FilesIn(r.Store) {
+			if dir := r.foldedDir(file, folded); dir != "" {
+				if !seen[dir] {
+					seen[dir] = true
+					c <- r.dotFile(dir, true)
+				}
 				continue
 			}
 
-			df := dotfile.DotFile{
-				StoredLocation:   symlink,
-				OriginalLocation: r.OriginalFilePath(symlink),
-				AliasTarget:      aliasTarget,
+			if filepath.Base(file) != dotfile.DirFile && r.IsActive(file) {
+				c <- r.dotFile(file, false)
 			}
+		}
 
-			noConflict := df.IsGeneric() && !fsutil.Exists(df.StoredLocation+host.DotFileLocalSuffix())
+		for symlink := range fsutil.SymlinksIn(r.Store) {
+			if r.foldedDir(symlink, folded) != "" || !r.IsActive(symlink) {
+				continue
+			}
 
-			if df.IsFromThisHost() || noConflict {
-				c <- &df
+			if df := r.DotFile(symlink); df.IsAlias() {
+				c <- df
 			}
 		}
 
@@ -85,32 +128,372 @@ func (r *Repo) StoredDotFiles() <-chan *dotfile.DotFile {
 	return dotFileChan
 }
 
-// OriginalFilePath computes original path of dotfile (where it should be
-// symlinked) based on path where it is stored.
-func (r *Repo) OriginalFilePath(stored string) string {
+// IsActive returns true if file at given location in store is the one used
+// on current host. Host suffixes can be put on names of both files and
+// directories. Files with suffixes of other hosts anywhere in their paths are
+// not used, and neither are generic files or whole directories shadowed by
+// their variants specific to current host. Files with malformed names are
+// never used.
+func (r *Repo) IsActive(stored string) bool {
+	if l := r.Layer(stored); l != r {
+		return l.IsActive(stored)
+	}
+
+	v, err := r.Variant(stored)
+
+	if err != nil || !v.IsFor(host.Name()) {
+		return false
+	}
+
+	dir := r.Store
+
+	for i, part := range splitPath(r.relPath(stored)) {
+		if c := v.Components[i]; c.Host == "" && hasHostVariant(dir, c.Name) {
+			return false
+		}
+
+		dir = filepath.Join(dir, part)
+	}
+
+	return true
+}
+
+// Variant parses location of file in store.
+func (r *Repo) Variant(stored string) (variant.Variant, error) {
+	if l := r.Layer(stored); l != r {
+		return l.Variant(stored)
+	}
+
+	if !r.IsInStore(stored) {
+		return variant.Variant{}, fmt.Errorf("%s is not in store", stored)
+	}
+
+	return variant.Parse(r.relPath(stored))
+}
+
+func (r *Repo) relPath(stored string) string {
 	relPath, err := filepath.Rel(r.Store, stored)
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	relPath = regexp.MustCompile(`\.force-copy`).ReplaceAllLiteralString(relPath, "")
-	relPath = host.RemoveSuffix(relPath)
+	return relPath
+}
 
-	return filepath.Join(r.Home, "."+relPath)
+func splitPath(path string) []string {
+	return strings.Split(filepath.ToSlash(path), "/")
 }
 
-// StoredFilePath computes a path for stored dotfile corresponding to a given
-// original path.
-func (r *Repo) StoredFilePath(orig string, hostSpecific bool, forceCopy bool) (string, error) {
+// hasHostVariant returns true if directory contains variant of file or
+// directory with given generic name specific to current host.
+func hasHostVariant(dir, name string) bool {
+	entries, _ := os.ReadDir(dir)
+
+	for _, entry := range entries {
+		c, err := variant.ParseComponent(entry.Name())
+
+		if err == nil && c.Name == name && c.Host == host.Name() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DotFile returns DotFile object for file at given location in store. Alias
+// symlinks get their targets resolved, attributes from store metadata are
+// applied.
+func (r *Repo) DotFile(stored string) *dotfile.DotFile {
+	if l := r.Layer(stored); l != r {
+		return l.DotFile(stored)
+	}
+
+	return r.dotFile(stored, r.IsFolded(stored))
+}
+
+// dotFile returns DotFile object for file at given location in store of repo
+// itself, whether it is folded is given rather than determined.
+func (r *Repo) dotFile(stored string, folded bool) *dotfile.DotFile {
+	meta := r.Meta(stored)
+	mode, _ := meta.FileMode()
+
+	df := &dotfile.DotFile{
+		StoredLocation:   stored,
+		OriginalLocation: r.OriginalFilePath(stored),
+		Folded:           folded,
+		Style:            meta.Style,
+		Mode:             mode,
+	}
+
+	if df.Style == "" || df.Style == dotfile.StyleSymlink {
+		df.Style = r.LinkStyle
+	}
+
+	if fsutil.IsRelativeSymlinkWithinDir(stored, r.Store) {
+		if target, err := r.ResolveAlias(stored); err == nil {
+			df.AliasTarget = target
+		}
+	}
+
+	return df
+}
+
+// ResolveAlias returns location of stored file alias symlink ultimately
+// points to. Target is chosen among variants of file alias points to the
+// same way as for regular dotfiles (variant specific to current host wins
+// over generic one, unless alias explicitly points to host-specific file),
+// aliases pointing to other aliases are followed.
+func (r *Repo) ResolveAlias(symlink string) (string, error) {
+	if l := r.Layer(symlink); l != r {
+		return l.ResolveAlias(symlink)
+	}
+
+	seen := map[string]bool{symlink: true}
+
+	for current := symlink; ; {
+		if !fsutil.IsRelativeSymlinkWithinDir(current, r.Store) {
+			return "", fmt.Errorf("%s is not a relative symlink within store", current)
+		}
+
+		literal, err := fsutil.ResolveSymlink(current)
+
+		if err != nil {
+			return "", err
+		}
+
+		target := r.activeVariant(literal)
+
+		if seen[target] {
+			return "", fmt.Errorf("alias cycle at %s", target)
+		}
+
+		if fsutil.IsRegularFile(target) {
+			return target, nil
+		}
+
+		if !fsutil.IsSymlink(target) {
+			return "", fmt.Errorf("%s is not stored", target)
+		}
+
+		seen[target] = true
+		current = target
+	}
+}
+
+// activeVariant returns location of variant of stored file at given location
+// which is used on current host: variants specific to current host (of file
+// itself or of any directory it is in) take precedence over given location,
+// which takes precedence over other generic variants. Explicitly
+// host-specific locations are returned as is.
+func (r *Repo) activeVariant(stored string) string {
+	v, err := r.Variant(stored)
+
+	if err != nil || !v.IsGeneric() {
+		return stored
+	}
+
+	path := r.Store
+
+	for i, part := range splitPath(r.relPath(stored)) {
+		path = filepath.Join(path, pickVariant(path, part, v.Components[i].Name))
+	}
+
+	return path
+}
+
+// pickVariant returns name of entry in given directory which is used on
+// current host in place of entry with given name and generic name: variant
+// specific to current host (symlinked one first), entry itself or another
+// generic variant (symlinked one first). Returns given name if none exist.
+func pickVariant(dir, name, generic string) string {
+	rank := func(entry string) int {
+		c, err := variant.ParseComponent(entry)
+
+		switch {
+		case err != nil || c.Name != generic:
+			return -1
+		case c.Host == host.Name() && !c.Copy:
+			return 0
+		case c.Host == host.Name():
+			return 1
+		case entry == name:
+			return 2
+		case c.Host == "" && !c.Copy:
+			return 3
+		case c.Host == "":
+			return 4
+		}
+
+		return -1
+	}
+
+	best, bestRank := name, -1
+	entries, _ := os.ReadDir(dir)
+
+	for _, entry := range entries {
+		if entryRank := rank(entry.Name()); entryRank >= 0 && (bestRank < 0 || entryRank < bestRank) {
+			best, bestRank = entry.Name(), entryRank
+		}
+	}
+
+	return best
+}
+
+// Glob returns locations of stored files matching given store-relative
+// pattern, in any of stores. Hidden files in store root (like VCS metadata
+// and dfm's own settings files) and directory settings files are never
+// matched.
+func (r *Repo) Glob(pattern string) []string {
+	var result []string
+
+	if !isID(pattern) {
+		return result
+	}
+
+	for _, l := range r.Layers() {
+		matches, _ := filepath.Glob(filepath.Join(l.Store, pattern))
+
+		for _, match := range matches {
+			if l.inStore(match) && !strings.HasPrefix(l.relPath(match), ".") && filepath.Base(match) != dotfile.DirFile {
+				result = append(result, match)
+			}
+		}
+	}
+
+	return result
+}
+
+// isID returns true if command line argument can be an id of stored file,
+// which is not the case for absolute paths and paths explicitly relative to
+// current directory (like "./foo" or "../foo").
+func isID(arg string) bool {
+	if filepath.IsAbs(arg) || arg == "." || arg == ".." {
+		return false
+	}
+
+	return !strings.HasPrefix(arg, "./") && !strings.HasPrefix(arg, "../")
+}
+
+// IsInStore returns true if given absolute path is located within any of
+// stores.
+func (r *Repo) IsInStore(path string) bool {
+	return r.Layer(path).inStore(path)
+}
+
+// ResolvePath turns command line argument into absolute path. Relative
+// arguments are interpreted as store-relative ids if such files exist in
+// any of stores (highest priority one wins), as paths relative to current
+// directory otherwise. Arguments starting with "./" or "../" are always
+// paths.
+func (r *Repo) ResolvePath(arg string) (string, error) {
+	if isID(arg) {
+		for _, l := range r.Layers() {
+			if id := filepath.Join(l.Store, arg); l.inStore(id) && fsutil.Exists(id) {
+				return id, nil
+			}
+		}
+	}
+
+	return filepath.Abs(arg)
+}
+
+// Selects returns true if dotfile is located at given absolute path or
+// somewhere under it, either in home directory or in store.
+func Selects(df *dotfile.DotFile, path string) bool {
+	return fsutil.IsUnder(df.OriginalLocation, path) || fsutil.IsUnder(df.StoredLocation, path)
+}
+
+// IgnorePatterns returns patterns listed in ignore files of all stores, one
+// per line. Empty lines and lines starting with "#" are skipped.
+func (r *Repo) IgnorePatterns() []string {
+	var patterns []string
+
+	for _, l := range r.Layers() {
+		patterns = append(patterns, readPatterns(filepath.Join(l.Store, IgnoreFile))...)
+	}
+
+	return patterns
+}
+
+// IsIgnored returns true if given path in home directory matches any of
+// given ignore patterns.
+func (r *Repo) IsIgnored(orig string, patterns []string) bool {
+	return r.matches(orig, patterns)
+}
+
+// matches returns true if given path in home directory matches any of given
+// patterns. Patterns containing "/" are matched against path relative to
+// home directory, others - against base name of file.
+func (r *Repo) matches(orig string, patterns []string) bool {
 	relPath, err := filepath.Rel(r.Home, orig)
 
 	if err != nil {
-		return "", err
+		return false
 	}
 
-	if !strings.HasPrefix(relPath, ".") {
-		return "", fmt.Errorf("%s is not a dotfile", orig)
+	for _, pattern := range patterns {
+		subject := filepath.Base(orig)
+
+		if strings.Contains(pattern, "/") {
+			subject = relPath
+			pattern = strings.TrimPrefix(pattern, "/")
+		}
+
+		if matched, _ := filepath.Match(pattern, subject); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StoredDotFile returns DotFile object for stored dotfile used on current
+// host that gets linked to given original location, or nil if there is none.
+// Only directories on the way to it are looked into, not the whole store.
+func (r *Repo) StoredDotFile(orig string) *dotfile.DotFile {
+	for _, l := range r.Layers() {
+		generic, err := l.genericStoredFilePath(orig)
+
+		if err != nil {
+			continue
+		}
+
+		stored := l.activeVariant(generic)
+
+		if _, err := os.Lstat(stored); err != nil || !l.IsActive(stored) || l.OriginalFilePath(stored) != orig {
+			continue
+		}
+
+		if df := l.DotFile(stored); !fsutil.IsSymlink(stored) || df.IsAlias() {
+			return df
+		}
+	}
+
+	return nil
+}
+
+// OriginalFilePath computes original path of dotfile (where it should be
+// symlinked) based on path where it is stored.
+func (r *Repo) OriginalFilePath(stored string) string {
+	if l := r.Layer(stored); l != r {
+		return l.OriginalFilePath(stored)
+	}
+
+	relPath := r.relPath(stored)
+
+	if v, err := variant.Parse(relPath); err == nil {
+		relPath = v.Base()
+	}
+
+	return filepath.Join(r.Home, "."+relPath)
+}
+
+// StoredFilePath computes a path for stored dotfile corresponding to a given
+// original path, in store it gets stored into (see LayerFor).
+func (r *Repo) StoredFilePath(orig string, hostSpecific bool, forceCopy bool) (string, error) {
+	if _, err := r.genericStoredFilePath(orig); err != nil {
+		return "", err
 	}
 
 	// Handle case when file is host-local and already linked.
@@ -119,20 +502,56 @@ func (r *Repo) StoredFilePath(orig string, hostSpecific bool, forceCopy bool) (s
 			st = filepath.Join(filepath.Dir(orig), st)
 		}
 
-		if strings.HasSuffix(st, host.DotFileLocalSuffix()) {
+		if v, err := r.Variant(st); err == nil && !v.IsGeneric() && r.IsActive(st) && r.OriginalFilePath(st) == orig {
 			return st, nil
 		}
 	}
 
-	storedRelPath := strings.TrimPrefix(relPath, ".")
+	return r.LayerFor(orig).VariantFilePath(orig, hostSpecific, forceCopy)
+}
+
+// VariantFilePath computes a path for stored dotfile of given variant
+// corresponding to a given original path, in store of repo itself.
+func (r *Repo) VariantFilePath(orig string, hostSpecific bool, forceCopy bool) (string, error) {
+	storedPath, err := r.genericStoredFilePath(orig)
+
+	if err != nil {
+		return "", err
+	}
+
+	hostName := ""
 
 	if hostSpecific {
-		storedRelPath += host.DotFileLocalSuffix()
+		hostName = host.Name()
+
+		if err := variant.CheckHost(hostName); err != nil {
+			return "", err
+		}
+	}
+
+	v := variant.New(r.relPath(storedPath), hostName, forceCopy)
+
+	return filepath.Join(r.Store, v.Path()), nil
+}
+
+// genericStoredFilePath computes a path for generic stored dotfile
+// corresponding to a given original path.
+func (r *Repo) genericStoredFilePath(orig string) (string, error) {
+	relPath, err := filepath.Rel(r.Home, orig)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasPrefix(relPath, ".") {
+		return "", fmt.Errorf("%s is not a dotfile", orig)
 	}
 
-	if forceCopy {
-		storedRelPath += ".force-copy"
+	relPath = strings.TrimPrefix(relPath, ".")
+
+	if v, err := variant.Parse(relPath); err != nil || !v.IsGeneric() || v.IsCopy() || v.IsHardlink() || v.IsSymlink() {
+		return "", fmt.Errorf("%s has name that looks like variant of another file", orig)
 	}
 
-	return filepath.Join(r.Store, storedRelPath), nil
+	return filepath.Join(r.Store, relPath), nil
 }
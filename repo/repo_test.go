@@ -134,6 +134,123 @@ var _ = Describe("Repo", func() {
 				Expect(dotfiles).To(HaveLen(1))
 				Expect(dotfiles[0].StoredLocation).To(Equal(expected))
 			})
+
+			It("favors host-specific force-copy files over generic ones", func() {
+				repo := New(".", ".")
+				CreateFile("bashrc")
+				CreateFile("bashrc.host-myhost.force-copy")
+
+				expected, _ := filepath.Abs("bashrc.host-myhost.force-copy")
+				dotfiles := chanToSlice(repo.StoredDotFiles())
+				Expect(dotfiles).To(HaveLen(1))
+				Expect(dotfiles[0].StoredLocation).To(Equal(expected))
+			})
+
+			It("accepts suffixes in any order", func() {
+				repo := New(".", ".")
+				CreateFile("bashrc")
+				CreateFile("bashrc.force-copy.host-myhost")
+
+				expected, _ := filepath.Abs("bashrc.force-copy.host-myhost")
+				dotfiles := chanToSlice(repo.StoredDotFiles())
+				Expect(dotfiles).To(HaveLen(1))
+				Expect(dotfiles[0].StoredLocation).To(Equal(expected))
+				Expect(dotfiles[0].MustBeCopied()).To(BeTrue())
+			})
+
+			It("ignores files with malformed names", func() {
+				repo := New(".", ".")
+				CreateFile("bashrc.host-myhost.bak")
+				CreateFile("bashrc.force-copy.force-copy")
+
+				Expect(chanToSlice(repo.StoredDotFiles())).To(BeEmpty())
+			})
+
+			It("does not confuse hosts with common name prefix", func() {
+				repo := New(".", ".")
+				CreateFile("bashrc.host-myhostname")
+
+				Expect(chanToSlice(repo.StoredDotFiles())).To(BeEmpty())
+			})
+
+			Context("directory-level variants", func() {
+				storedIDs := func(repo *Repo) []string {
+					var ids []string
+					for _, df := range chanToSlice(repo.StoredDotFiles()) {
+						id, _ := filepath.Rel(repo.Store, df.StoredLocation)
+						ids = append(ids, id)
+					}
+					return ids
+				}
+
+				It("replaces whole generic subtree with one specific to current host", func() {
+					repo := New("store", "home")
+					CreateFile("store/config/i3/config")
+					CreateFile("store/config/i3/status")
+					CreateFile("store/config/i3.host-myhost/config")
+					CreateFile("store/config/git/config")
+
+					Expect(storedIDs(repo)).To(ConsistOf(
+						"config/i3.host-myhost/config",
+						"config/git/config",
+					))
+				})
+
+				It("ignores subtrees specific to other hosts", func() {
+					repo := New("store", "home")
+					CreateFile("store/config/i3/config")
+					CreateFile("store/config/i3.host-otherhost/config")
+					CreateFile("store/config/i3.host-otherhost/status")
+
+					Expect(storedIDs(repo)).To(ConsistOf("config/i3/config"))
+				})
+
+				It("ignores file-level variants within replaced subtree", func() {
+					repo := New("store", "home")
+					CreateFile("store/config/i3/config.host-myhost")
+					CreateFile("store/config/i3.host-myhost/config")
+
+					Expect(storedIDs(repo)).To(ConsistOf("config/i3.host-myhost/config"))
+				})
+
+				It("applies file-level variants within host-specific subtree", func() {
+					repo := New("store", "home")
+					CreateFile("store/config/i3.host-myhost/config")
+					CreateFile("store/config/i3.host-myhost/config.host-myhost")
+					CreateFile("store/config/i3.host-myhost/status.host-otherhost")
+
+					Expect(storedIDs(repo)).To(ConsistOf("config/i3.host-myhost/config.host-myhost"))
+				})
+
+				It("applies file-level variants within generic subtree", func() {
+					repo := New("store", "home")
+					CreateFile("store/config/i3/config")
+					CreateFile("store/config/i3/config.host-myhost")
+					CreateFile("store/config/i3.host-otherhost/config")
+
+					Expect(storedIDs(repo)).To(ConsistOf("config/i3/config.host-myhost"))
+				})
+
+				It("copies files from force-copy subtree", func() {
+					repo := New("store", "home")
+					CreateFile("store/config/app.force-copy/settings")
+
+					dotfiles := chanToSlice(repo.StoredDotFiles())
+					Expect(dotfiles).To(HaveLen(1))
+					Expect(dotfiles[0].MustBeCopied()).To(BeTrue())
+					Expect(dotfiles[0].OriginalLocation).To(Equal(filepath.Join(repo.Home, ".config/app/settings")))
+				})
+
+				It("resolves aliases into host-specific subtree", func() {
+					repo := New("store", "home")
+					CreateFile("store/config/i3/config")
+					CreateFile("store/config/i3.host-myhost/config")
+					os.Symlink("config/i3/config", "store/i3config")
+
+					df := repo.DotFile(filepath.Join(repo.Store, "i3config"))
+					Expect(df.AliasTarget).To(Equal(filepath.Join(repo.Store, "config/i3.host-myhost/config")))
+				})
+			})
 		})
 
 		Context("alias symlinks", func() {
@@ -216,6 +333,258 @@ var _ = Describe("Repo", func() {
 		})
 	})
 
+	Describe("DotFile", func() {
+		ExecuteEachInTempDir()
+
+		It("computes original location", func() {
+			CreateFile("store/bashrc.host-foo.force-copy")
+			repo := New("store", "home")
+
+			df := repo.DotFile(filepath.Join(repo.Store, "bashrc.host-foo.force-copy"))
+			Expect(df.OriginalLocation).To(Equal(filepath.Join(repo.Home, ".bashrc")))
+			Expect(df.MustBeCopied()).To(BeTrue())
+			Expect(df.IsAlias()).To(BeFalse())
+		})
+
+		It("resolves alias targets", func() {
+			CreateFile("store/bashrc")
+			os.Symlink("bashrc", "store/bash_profile")
+			repo := New("store", "home")
+
+			df := repo.DotFile(filepath.Join(repo.Store, "bash_profile"))
+			Expect(df.AliasTarget).To(Equal(filepath.Join(repo.Store, "bashrc")))
+		})
+	})
+
+	Describe("StoredDotFile", func() {
+		ExecuteEachInTempDir()
+
+		It("returns dotfile used for given original location", func() {
+			CreateFile("store/config/fonts.dfm-symlink")
+			repo := New("store", "home")
+
+			df := repo.StoredDotFile(filepath.Join(repo.Home, ".config/fonts"))
+			Expect(df).NotTo(BeNil())
+			Expect(df.StoredLocation).To(Equal(filepath.Join(repo.Store, "config/fonts.dfm-symlink")))
+			Expect(df.IsSymlinkEntry()).To(BeTrue())
+		})
+
+		It("returns nil if nothing is stored for given location", func() {
+			CreateFile("store/bashrc")
+			repo := New("store", "home")
+
+			Expect(repo.StoredDotFile(filepath.Join(repo.Home, ".zshrc"))).To(BeNil())
+		})
+	})
+
+	Describe("ResolveAlias", func() {
+		ExecuteEachInTempDir()
+		ExecuteEachWithHostName("myhost")
+
+		var repo *Repo
+
+		BeforeEach(func() {
+			repo = New("store", "home")
+		})
+
+		stored := func(id string) string {
+			return filepath.Join(repo.Store, id)
+		}
+
+		It("resolves to variant specific to current host", func() {
+			CreateFile("store/bashrc")
+			CreateFile("store/bashrc.host-myhost")
+			CreateFile("store/bashrc.host-otherhost")
+			os.Symlink("bashrc", "store/bash_profile")
+
+			Expect(repo.ResolveAlias(stored("bash_profile"))).To(Equal(stored("bashrc.host-myhost")))
+		})
+
+		It("keeps explicitly host-specific target", func() {
+			CreateFile("store/bashrc.host-otherhost")
+			CreateFile("store/bashrc.host-myhost")
+			os.Symlink("bashrc.host-otherhost", "store/bash_profile")
+
+			Expect(repo.ResolveAlias(stored("bash_profile"))).To(Equal(stored("bashrc.host-otherhost")))
+		})
+
+		It("resolves to force-copy variant", func() {
+			CreateFile("store/bashrc.force-copy")
+			os.Symlink("bashrc", "store/bash_profile")
+
+			Expect(repo.ResolveAlias(stored("bash_profile"))).To(Equal(stored("bashrc.force-copy")))
+			Expect(repo.DotFile(stored("bash_profile")).MustBeCopied()).To(BeTrue())
+		})
+
+		It("follows chains of aliases", func() {
+			CreateFile("store/bashrc")
+			os.Symlink("bashrc", "store/bash_profile")
+			os.Symlink("bash_profile", "store/profile")
+
+			Expect(repo.ResolveAlias(stored("profile"))).To(Equal(stored("bashrc")))
+		})
+
+		It("resolves variants along the chain", func() {
+			CreateFile("store/bashrc")
+			CreateFile("store/zshrc")
+			os.Symlink("bashrc", "store/bash_profile")
+			os.Symlink("zshrc", "store/bash_profile.host-myhost")
+			os.Symlink("bash_profile", "store/profile")
+
+			Expect(repo.ResolveAlias(stored("profile"))).To(Equal(stored("zshrc")))
+		})
+
+		It("detects cycles", func() {
+			CreateDir("store")
+			os.Symlink("bar", "store/foo")
+			os.Symlink("baz", "store/bar")
+			os.Symlink("foo", "store/baz")
+
+			_, err := repo.ResolveAlias(stored("foo"))
+			Expect(err).NotTo(Succeed())
+			Expect(repo.DotFile(stored("foo")).IsAlias()).To(BeFalse())
+		})
+
+		It("fails for dangling aliases", func() {
+			CreateDir("store")
+			os.Symlink("bashrc", "store/bash_profile")
+
+			_, err := repo.ResolveAlias(stored("bash_profile"))
+			Expect(err).NotTo(Succeed())
+		})
+	})
+
+	Describe("Glob", func() {
+		ExecuteEachInTempDir()
+
+		It("returns stored files matching pattern", func() {
+			CreateFile("store/config/foo")
+			CreateFile("store/config/bar")
+			CreateFile("store/baz")
+			repo := New("store", "home")
+
+			Expect(repo.Glob("config/*")).To(ConsistOf(
+				filepath.Join(repo.Store, "config/bar"),
+				filepath.Join(repo.Store, "config/foo"),
+			))
+		})
+
+		It("ignores matches outside of store", func() {
+			CreateFile("store/foo")
+			CreateFile("outside")
+			repo := New("store", "home")
+
+			Expect(repo.Glob("../outside")).To(BeEmpty())
+			Expect(repo.Glob("../store")).To(BeEmpty())
+		})
+
+		It("ignores hidden files in store root and directory settings", func() {
+			CreateFile("store/foo")
+			CreateFile("store/.git/config")
+			CreateFile("store/.dfmignore")
+			CreateFile("store/vim/.dfmdir")
+			CreateFile("store/vim/.netrwhist")
+			repo := New("store", "home")
+
+			Expect(repo.Glob("*")).To(ConsistOf(
+				filepath.Join(repo.Store, "foo"),
+				filepath.Join(repo.Store, "vim"),
+			))
+			Expect(repo.Glob("vim/*")).To(ConsistOf(filepath.Join(repo.Store, "vim/.netrwhist")))
+		})
+	})
+
+	Describe("ResolvePath", func() {
+		ExecuteEachInTempDir()
+
+		It("interprets relative path as store id if such file is stored", func() {
+			CreateFile("store/config/foo")
+			repo := New("store", "home")
+
+			path, err := repo.ResolvePath("config/foo")
+			Expect(err).To(Succeed())
+			Expect(path).To(Equal(filepath.Join(repo.Store, "config/foo")))
+		})
+
+		It("interprets relative path as relative to current directory otherwise", func() {
+			repo := New("store", "home")
+			expected, _ := filepath.Abs("home/.foo")
+
+			path, err := repo.ResolvePath("home/.foo")
+			Expect(err).To(Succeed())
+			Expect(path).To(Equal(expected))
+		})
+
+		It("interprets path explicitly relative to current directory as such", func() {
+			CreateFile("store/config/foo")
+			repo := New("store", "home")
+			expected, _ := filepath.Abs("config/foo")
+
+			path, err := repo.ResolvePath("./config/foo")
+			Expect(err).To(Succeed())
+			Expect(path).To(Equal(expected))
+		})
+
+		It("leaves absolute paths alone", func() {
+			CreateFile("store/foo")
+			repo := New("store", "home")
+
+			path, err := repo.ResolvePath("/foo")
+			Expect(err).To(Succeed())
+			Expect(path).To(Equal("/foo"))
+		})
+	})
+
+	Describe("Selects", func() {
+		df := dotfile.New("/store/config/nvim/init.lua", "/home/.config/nvim/init.lua")
+
+		It("selects dotfiles by original location", func() {
+			Expect(Selects(df, "/home/.config/nvim/init.lua")).To(BeTrue())
+			Expect(Selects(df, "/home/.config/nvim")).To(BeTrue())
+			Expect(Selects(df, "/home/.config/vim")).To(BeFalse())
+		})
+
+		It("selects dotfiles by stored location", func() {
+			Expect(Selects(df, "/store/config/nvim/init.lua")).To(BeTrue())
+			Expect(Selects(df, "/store/config")).To(BeTrue())
+			Expect(Selects(df, "/store/config/vim")).To(BeFalse())
+		})
+	})
+
+	Describe("IgnorePatterns", func() {
+		ExecuteEachInTempDir()
+
+		It("returns empty list if there's no ignore file", func() {
+			Expect(New("store", "home").IgnorePatterns()).To(BeEmpty())
+		})
+
+		It("skips empty lines and comments", func() {
+			CreateFileWithContent("store/"+IgnoreFile, []byte("# comment\n\n*.swp\n  .config/nvim/undo  \n"))
+
+			Expect(New("store", "home").IgnorePatterns()).To(Equal([]string{"*.swp", ".config/nvim/undo"}))
+		})
+	})
+
+	Describe("IsIgnored", func() {
+		repo := New("/store", "/home")
+
+		It("matches patterns without slashes against base names", func() {
+			Expect(repo.IsIgnored("/home/.config/nvim/foo.swp", []string{"*.swp"})).To(BeTrue())
+			Expect(repo.IsIgnored("/home/.config/nvim/foo.lua", []string{"*.swp"})).To(BeFalse())
+		})
+
+		It("matches patterns with slashes against paths relative to home", func() {
+			patterns := []string{".config/nvim/undo"}
+
+			Expect(repo.IsIgnored("/home/.config/nvim/undo", patterns)).To(BeTrue())
+			Expect(repo.IsIgnored("/home/.config/vim/undo", patterns)).To(BeFalse())
+		})
+
+		It("allows leading slash in patterns", func() {
+			Expect(repo.IsIgnored("/home/.cache", []string{"/.cache"})).To(BeTrue())
+		})
+	})
+
 	Describe("OriginalFilePath", func() {
 		repo := New("/store", "/")
 
@@ -287,6 +656,17 @@ var _ = Describe("Repo", func() {
 			Expect(stored).To(Equal(filepath.Join(repo.Store, "config/camlistore/server-config.json")))
 		})
 
+		It("fails if name of file looks like variant of another one", func() {
+			_, err := repo.StoredFilePath(filepath.Join(repo.Home, ".bashrc.force-copy"), false, false)
+			Expect(err).NotTo(Succeed())
+
+			_, err = repo.StoredFilePath(filepath.Join(repo.Home, ".bashrc.host-foo"), false, false)
+			Expect(err).NotTo(Succeed())
+
+			_, err = repo.StoredFilePath(filepath.Join(repo.Home, ".bashrc.dfm-symlink"), false, false)
+			Expect(err).NotTo(Succeed())
+		})
+
 		It("fails if path from home directory does not start with dot", func() {
 			df, err := repo.StoredFilePath(filepath.Join(repo.Home, "bashrc"), false, false)
 
@@ -304,6 +684,15 @@ var _ = Describe("Repo", func() {
 				Expect(df).To(HaveSuffix(".host-myhost"))
 			})
 
+			Context("host name has dots in it", func() {
+				ExecuteEachWithHostName("myhost.local")
+
+				It("fails", func() {
+					_, err := repo.StoredFilePath(filepath.Join(repo.Home, ".bashrc"), true, false)
+					Expect(err).NotTo(Succeed())
+				})
+			})
+
 			Context("original file is a link", func() {
 				ExecuteEachInTempDir()
 
@@ -318,6 +707,17 @@ var _ = Describe("Repo", func() {
 					Expect(stored).To(HaveSuffix(".host-myhost"))
 				})
 
+				It("returns generic file path if linked to host-specific file with other original location", func() {
+					repo := New(".", ".")
+					CreateFile("foo.host-myhost")
+					os.Symlink("foo.host-myhost", ".bar")
+
+					stored, err := repo.StoredFilePath(filepath.Join(repo.Home, ".bar"), false, false)
+
+					Expect(err).To(Succeed())
+					Expect(stored).To(HaveSuffix("/bar"))
+				})
+
 				It("returns generic file path if linked to file specific to other host", func() {
 					repo := New(".", ".")
 					CreateFile("foo.host-otherhost")
@@ -342,4 +742,28 @@ var _ = Describe("Repo", func() {
 			})
 		})
 	})
+
+	Describe("VariantFilePath", func() {
+		ExecuteEachInTempDir()
+		ExecuteEachWithHostName("myhost")
+
+		repo := New("/store", "/")
+		orig := filepath.Join(repo.Home, ".bashrc")
+
+		It("returns generic file path", func() {
+			Expect(repo.VariantFilePath(orig, false, false)).To(Equal(filepath.Join(repo.Store, "bashrc")))
+		})
+
+		It("returns host-specific force-copy file path", func() {
+			Expect(repo.VariantFilePath(orig, true, true)).To(Equal(filepath.Join(repo.Store, "bashrc.host-myhost.force-copy")))
+		})
+
+		It("ignores file linked at original location", func() {
+			repo := New(".", ".")
+			CreateFile("foo.host-myhost")
+			os.Symlink("foo.host-myhost", ".foo")
+
+			Expect(repo.VariantFilePath(filepath.Join(repo.Home, ".foo"), false, false)).To(Equal(filepath.Join(repo.Store, "foo")))
+		})
+	})
 })
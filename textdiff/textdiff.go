@@ -0,0 +1,368 @@
+package textdiff
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of diff lines.
+const (
+	Same    = ' '
+	Removed = '-'
+	Added   = '+'
+)
+
+// Line is a single line of diff.
+type Line struct {
+	Kind byte
+	Text string
+}
+
+// ContextLines is a number of unchanged lines shown around changes in unified
+// diff.
+const ContextLines = 3
+
+func split(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// Lines computes line-by-line difference between a and b. Within every
+// change removed lines go before added ones. Difference is computed with
+// linear space variation of Myers' algorithm, so memory used is proportional
+// to sizes of inputs, and time - to sizes of inputs and of difference.
+func Lines(a, b string) []Line {
+	d := &differ{a: split(a), b: split(b)}
+	d.diff(0, len(d.a), 0, len(d.b))
+
+	return groupChanges(d.lines)
+}
+
+type differ struct {
+	a, b  []string
+	lines []Line
+}
+
+func (d *differ) emit(kind byte, lines []string) {
+	for _, l := range lines {
+		d.lines = append(d.lines, Line{kind, l})
+	}
+}
+
+// diff appends difference between a[aLo:aHi] and b[bLo:bHi] to lines.
+func (d *differ) diff(aLo, aHi, bLo, bHi int) {
+	prefix := aLo
+
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+
+	d.emit(Same, d.a[prefix:aLo])
+
+	suffix := aHi
+
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	switch {
+	case aLo == aHi:
+		d.emit(Added, d.b[bLo:bHi])
+	case bLo == bHi:
+		d.emit(Removed, d.a[aLo:aHi])
+	default:
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.diff(aLo, x, bLo, y)
+		d.emit(Same, d.a[x:u])
+		d.diff(u, aHi, v, bHi)
+	}
+
+	d.emit(Same, d.a[aHi:suffix])
+}
+
+// middleSnake finds the middle snake of shortest edit script turning
+// a[aLo:aHi] into b[bLo:bHi], which are both non-empty and have different
+// first and last lines. Snake goes from a[x], b[y] to a[u], b[v].
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	max := (n + m + 1) / 2
+	offset := max + 1
+
+	// forward[k] is the furthest x reached on diagonal k (x - y = k) going
+	// forward, backward[k] - the same going backward from the end, in
+	// coordinates counted from the end.
+	forward := make([]int, 2*max+3)
+	backward := make([]int, 2*max+3)
+
+	for edits := 0; edits <= max; edits++ {
+		for k := -edits; k <= edits; k += 2 {
+			x := forward[offset+k-1] + 1
+
+			if k == -edits || (k != edits && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			}
+
+			startX, y := x, x-k
+
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+
+			forward[offset+k] = x
+
+			if kb := delta - k; odd && kb >= -(edits-1) && kb <= edits-1 && x+backward[offset+kb] >= n {
+				return aLo + startX, bLo + startX - k, aLo + x, bLo + y
+			}
+		}
+
+		for k := -edits; k <= edits; k += 2 {
+			x := backward[offset+k-1] + 1
+
+			if k == -edits || (k != edits && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			}
+
+			startX, y := x, x-k
+
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+
+			backward[offset+k] = x
+
+			if kf := delta - k; !odd && kf >= -edits && kf <= edits && x+forward[offset+kf] >= n {
+				return aHi - x, bHi - y, aHi - startX, bHi - (startX - k)
+			}
+		}
+	}
+
+	panic("textdiff: middle snake not found")
+}
+
+// groupChanges reorders lines of every change (a run of added and removed
+// lines) so that removed ones go first.
+func groupChanges(lines []Line) []Line {
+	for start := 0; start < len(lines); start++ {
+		if lines[start].Kind == Same {
+			continue
+		}
+
+		end := start
+
+		for end < len(lines) && lines[end].Kind != Same {
+			end++
+		}
+
+		sort.SliceStable(lines[start:end], func(i, j int) bool {
+			return lines[start+i].Kind == Removed && lines[start+j].Kind == Added
+		})
+
+		start = end
+	}
+
+	return lines
+}
+
+// IsBinary returns true if content does not look like text, which is the case
+// when there are NUL bytes near its beginning. Binary content is not worth
+// computing line-by-line difference for.
+func IsBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// Summary describes how many lines were added and removed.
+type Summary struct{ Added, Removed int }
+
+// String returns short representation of summary, like "+3 -1".
+func (s Summary) String() string {
+	return fmt.Sprintf("+%d -%d", s.Added, s.Removed)
+}
+
+// Summarize counts lines added and removed between a and b.
+func Summarize(a, b string) Summary {
+	var s Summary
+
+	for _, l := range Lines(a, b) {
+		switch l.Kind {
+		case Added:
+			s.Added++
+		case Removed:
+			s.Removed++
+		}
+	}
+
+	return s
+}
+
+// Unified returns difference between a and b in unified diff format, empty
+// string if there is no difference.
+func Unified(aName, bName, a, b string) string {
+	lines := Lines(a, b)
+
+	var out strings.Builder
+	var aLine, bLine int
+
+	for start := 0; start < len(lines); {
+		if lines[start].Kind == Same {
+			aLine++
+			bLine++
+			start++
+			continue
+		}
+
+		// Found a change, extend hunk backwards by context and forward until
+		// there are more than 2*ContextLines unchanged lines in a row.
+		hunkStart := start - ContextLines
+
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+
+		end := start
+
+		for same := 0; end < len(lines) && same <= 2*ContextLines; end++ {
+			if lines[end].Kind == Same {
+				same++
+			} else {
+				same = 0
+			}
+		}
+
+		hunkEnd := end
+
+		for hunkEnd > start && lines[hunkEnd-1].Kind == Same && trailing(lines[start:hunkEnd]) > ContextLines {
+			hunkEnd--
+		}
+
+		aStart, bStart := aLine-(start-hunkStart)+1, bLine-(start-hunkStart)+1
+		var aCount, bCount int
+
+		for _, l := range lines[hunkStart:hunkEnd] {
+			if l.Kind != Added {
+				aCount++
+			}
+
+			if l.Kind != Removed {
+				bCount++
+			}
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+
+		for _, l := range lines[hunkStart:hunkEnd] {
+			out.WriteByte(l.Kind)
+			out.WriteString(l.Text)
+
+			if !strings.HasSuffix(l.Text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		for _, l := range lines[start:hunkEnd] {
+			if l.Kind != Added {
+				aLine++
+			}
+
+			if l.Kind != Removed {
+				bLine++
+			}
+		}
+
+		start = hunkEnd
+	}
+
+	return out.String()
+}
+
+// Merge turns a into b change by change, applying only changes accepted by
+// given function. Every change (a run of added and removed lines) is passed
+// to it together with up to ContextLines unchanged lines around it.
+func Merge(a, b string, accept func(change []Line) bool) string {
+	lines := Lines(a, b)
+
+	var out strings.Builder
+
+	for start := 0; start < len(lines); {
+		if lines[start].Kind == Same {
+			out.WriteString(lines[start].Text)
+			start++
+			continue
+		}
+
+		end := start
+
+		for end < len(lines) && lines[end].Kind != Same {
+			end++
+		}
+
+		from, to := start-ContextLines, end+ContextLines
+
+		if from < 0 {
+			from = 0
+		}
+
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		keep := byte(Removed)
+
+		if accept(lines[from:to]) {
+			keep = Added
+		}
+
+		for _, l := range lines[start:end] {
+			if l.Kind == keep {
+				out.WriteString(l.Text)
+			}
+		}
+
+		start = end
+	}
+
+	return out.String()
+}
+
+// trailing returns number of unchanged lines at the end of given lines.
+func trailing(lines []Line) int {
+	n := 0
+
+	for i := len(lines) - 1; i >= 0 && lines[i].Kind == Same; i-- {
+		n++
+	}
+
+	return n
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+
+	return fmt.Sprintf("%d,%d", start, count)
+}
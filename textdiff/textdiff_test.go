@@ -0,0 +1,132 @@
+package textdiff_test
+
+import (
+	"strings"
+
+	. "github.com/vderyagin/dfm/textdiff"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TextDiff", func() {
+	Describe("Lines", func() {
+		It("returns only unchanged lines for identical input", func() {
+			Expect(Lines("a\nb\n", "a\nb\n")).To(Equal([]Line{
+				{Same, "a\n"},
+				{Same, "b\n"},
+			}))
+		})
+
+		It("detects added and removed lines", func() {
+			Expect(Lines("a\nb\nc\n", "a\nc\nd\n")).To(Equal([]Line{
+				{Same, "a\n"},
+				{Removed, "b\n"},
+				{Same, "c\n"},
+				{Added, "d\n"},
+			}))
+		})
+
+		It("puts removed lines before added ones within a change", func() {
+			Expect(Lines("a\nb\nc\nd\n", "a\nx\ny\nd\n")).To(Equal([]Line{
+				{Same, "a\n"},
+				{Removed, "b\n"},
+				{Removed, "c\n"},
+				{Added, "x\n"},
+				{Added, "y\n"},
+				{Same, "d\n"},
+			}))
+		})
+
+		It("handles large input", func() {
+			a := strings.Repeat("line\n", 100000)
+			b := "first\n" + a[len("line\n"):] + "last\n"
+
+			Expect(Summarize(a, b)).To(Equal(Summary{Added: 2, Removed: 1}))
+		})
+
+		It("handles empty input", func() {
+			Expect(Lines("", "")).To(BeEmpty())
+			Expect(Lines("", "a\n")).To(Equal([]Line{{Added, "a\n"}}))
+		})
+	})
+
+	Describe("IsBinary", func() {
+		It("detects content with NUL bytes", func() {
+			Expect(IsBinary([]byte("foo\x00bar"))).To(BeTrue())
+			Expect(IsBinary([]byte("foo\nbar\n"))).To(BeFalse())
+		})
+	})
+
+	Describe("Summarize", func() {
+		It("counts added and removed lines", func() {
+			s := Summarize("a\nb\nc\n", "a\nB\nc\nd\n")
+			Expect(s.Added).To(Equal(2))
+			Expect(s.Removed).To(Equal(1))
+			Expect(s.String()).To(Equal("+2 -1"))
+		})
+	})
+
+	Describe("Unified", func() {
+		It("returns empty string for identical input", func() {
+			Expect(Unified("a", "b", "foo\n", "foo\n")).To(BeEmpty())
+		})
+
+		It("produces unified diff with context", func() {
+			a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+			b := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n"
+
+			Expect(Unified("a", "b", a, b)).To(Equal(
+				"--- a\n+++ b\n" +
+					"@@ -2,7 +2,7 @@\n" +
+					" 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n"))
+		})
+
+		It("splits distant changes into separate hunks", func() {
+			a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+			b := "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n"
+
+			Expect(Unified("a", "b", a, b)).To(Equal(
+				"--- a\n+++ b\n" +
+					"@@ -1,4 +1,4 @@\n" +
+					"-1\n+one\n 2\n 3\n 4\n" +
+					"@@ -9,4 +9,4 @@\n" +
+					" 9\n 10\n 11\n-12\n+twelve\n"))
+		})
+
+		It("marks missing newline at end of file", func() {
+			Expect(Unified("a", "b", "x\ny", "x\nz\n")).To(Equal(
+				"--- a\n+++ b\n" +
+					"@@ -1,2 +1,2 @@\n" +
+					" x\n-y\n\\ No newline at end of file\n+z\n"))
+		})
+	})
+
+	Describe("Merge", func() {
+		a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+		b := "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n"
+
+		It("applies accepted changes", func() {
+			Expect(Merge(a, b, func([]Line) bool { return true })).To(Equal(b))
+		})
+
+		It("leaves out rejected changes", func() {
+			Expect(Merge(a, b, func([]Line) bool { return false })).To(Equal(a))
+		})
+
+		It("passes every change with context separately", func() {
+			var changes [][]Line
+
+			merged := Merge(a, b, func(change []Line) bool {
+				changes = append(changes, change)
+				return len(changes) == 2
+			})
+
+			Expect(merged).To(Equal("1\n2\n3\n4\n5\n6\n7\n8\n9\nten\n"))
+			Expect(changes).To(HaveLen(2))
+			Expect(changes[0]).To(Equal([]Line{
+				{Removed, "1\n"}, {Added, "one\n"}, {Same, "2\n"}, {Same, "3\n"}, {Same, "4\n"},
+			}))
+		})
+	})
+})
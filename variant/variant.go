@@ -0,0 +1,298 @@
+package variant
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Suffixes marking variants of stored files.
+const (
+	HostPrefix     = ".host-"
+	CopySuffix     = ".force-copy"
+	HardlinkSuffix = ".hardlink"
+	SymlinkSuffix  = ".dfm-symlink"
+)
+
+var hostRegexp = regexp.MustCompile(`\A[[:alnum:]_-]+\z`)
+
+// HostSuffix returns suffix marking files specific to host with given name.
+func HostSuffix(name string) string {
+	return HostPrefix + name
+}
+
+// CheckHost makes sure that host name can be put in suffixes: names with
+// dots (like "foo.local") would be taken for names with other suffixes.
+func CheckHost(name string) error {
+	if !hostRegexp.MatchString(name) {
+		return fmt.Errorf("host name %q can not be used in file names, only letters, digits, \"-\" and \"_\" are allowed (set HOST environment variable to override it)", name)
+	}
+
+	return nil
+}
+
+// Component is a single component (file or directory name) of stored path,
+// with suffixes parsed out of it. Hardlink components are linked with hard
+// links, symlink components are files recording target of symlink instead of
+// being linked.
+type Component struct {
+	Name     string
+	Host     string
+	Copy     bool
+	Hardlink bool
+	Symlink  bool
+}
+
+// String returns name of component with its suffixes, host suffix going
+// first.
+func (c Component) String() string {
+	name := c.Name
+
+	if c.Host != "" {
+		name += HostSuffix(c.Host)
+	}
+
+	if c.Copy {
+		name += CopySuffix
+	}
+
+	if c.Hardlink {
+		name += HardlinkSuffix
+	}
+
+	if c.Symlink {
+		name += SymlinkSuffix
+	}
+
+	return name
+}
+
+// ParseComponent parses suffixes out of given file or directory name.
+// Suffixes can go in any order, but only at the end of name, and each only
+// once.
+func ParseComponent(name string) (Component, error) {
+	c := Component{Name: name}
+
+	for {
+		if strings.HasSuffix(c.Name, SymlinkSuffix) {
+			if c.Symlink {
+				return c, fmt.Errorf("%s: duplicate %s suffix", name, SymlinkSuffix)
+			}
+
+			c.Symlink = true
+			c.Name = strings.TrimSuffix(c.Name, SymlinkSuffix)
+			continue
+		}
+
+		if strings.HasSuffix(c.Name, HardlinkSuffix) {
+			if c.Hardlink {
+				return c, fmt.Errorf("%s: duplicate %s suffix", name, HardlinkSuffix)
+			}
+
+			c.Hardlink = true
+			c.Name = strings.TrimSuffix(c.Name, HardlinkSuffix)
+			continue
+		}
+
+		if strings.HasSuffix(c.Name, CopySuffix) {
+			if c.Copy {
+				return c, fmt.Errorf("%s: duplicate %s suffix", name, CopySuffix)
+			}
+
+			c.Copy = true
+			c.Name = strings.TrimSuffix(c.Name, CopySuffix)
+			continue
+		}
+
+		if i := strings.LastIndex(c.Name, HostPrefix); i >= 0 && hostRegexp.MatchString(c.Name[i+len(HostPrefix):]) {
+			if c.Host != "" {
+				return c, fmt.Errorf("%s: duplicate host suffix", name)
+			}
+
+			c.Host = c.Name[i+len(HostPrefix):]
+			c.Name = c.Name[:i]
+			continue
+		}
+
+		break
+	}
+
+	for _, suffix := range []string{HostPrefix, CopySuffix, HardlinkSuffix, SymlinkSuffix} {
+		if strings.Contains(c.Name, suffix) {
+			return c, fmt.Errorf("%s: malformed suffix", name)
+		}
+	}
+
+	if err := c.checkStyles(name); err != nil {
+		return c, err
+	}
+
+	if c.Name == "" && name != "" {
+		return c, fmt.Errorf("%s: suffix without name", name)
+	}
+
+	return c, nil
+}
+
+// checkStyles makes sure that component is not marked to be linked in more
+// than one way.
+func (c Component) checkStyles(name string) error {
+	switch {
+	case c.Copy && c.Symlink:
+		return fmt.Errorf("%s: symlinks can not be copied", name)
+	case c.Hardlink && c.Symlink:
+		return fmt.Errorf("%s: symlinks can not be hard links", name)
+	case c.Copy && c.Hardlink:
+		return fmt.Errorf("%s: files can not be both copied and hard linked", name)
+	}
+
+	return nil
+}
+
+// Variant is a parsed path of stored file. Host, copy and hardlink suffixes
+// can be put on any component of the path, applying to everything under it.
+type Variant struct {
+	Components []Component
+}
+
+// Parse parses stored path, which is either absolute or relative to store.
+// Paths with suffixes of different hosts are rejected, as they can not be
+// used anywhere, and so are symlink suffixes on directories.
+func Parse(path string) (Variant, error) {
+	var v Variant
+
+	parts := strings.Split(filepath.ToSlash(path), "/")
+
+	for i, part := range parts {
+		c, err := ParseComponent(part)
+
+		if err != nil {
+			return v, err
+		}
+
+		if c.Symlink && i < len(parts)-1 {
+			return v, fmt.Errorf("%s: directories can not be symlinks", path)
+		}
+
+		combined := Component{
+			Copy:     c.Copy || v.IsCopy(),
+			Hardlink: c.Hardlink || v.IsHardlink(),
+			Symlink:  c.Symlink,
+		}
+
+		if err := combined.checkStyles(path); err != nil {
+			return v, err
+		}
+
+		if c.Host != "" && v.Host() != "" && c.Host != v.Host() {
+			return v, fmt.Errorf("%s: conflicting host suffixes", path)
+		}
+
+		v.Components = append(v.Components, c)
+	}
+
+	return v, nil
+}
+
+// New returns variant of file with given base path, with suffixes put on file
+// name.
+func New(base, host string, copy bool) Variant {
+	v, _ := Parse(base)
+
+	for i := range v.Components {
+		v.Components[i].Host = ""
+		v.Components[i].Copy = false
+		v.Components[i].Hardlink = false
+	}
+
+	last := &v.Components[len(v.Components)-1]
+	last.Host = host
+	last.Copy = copy
+
+	return v
+}
+
+// Path returns stored path of variant.
+func (v Variant) Path() string {
+	parts := make([]string, len(v.Components))
+
+	for i, c := range v.Components {
+		parts[i] = c.String()
+	}
+
+	return filepath.FromSlash(strings.Join(parts, "/"))
+}
+
+// Base returns path with all suffixes removed.
+func (v Variant) Base() string {
+	parts := make([]string, len(v.Components))
+
+	for i, c := range v.Components {
+		parts[i] = c.Name
+	}
+
+	return filepath.FromSlash(strings.Join(parts, "/"))
+}
+
+// Host returns name of host variant is specific to, empty string for generic
+// variants.
+func (v Variant) Host() string {
+	for _, c := range v.Components {
+		if c.Host != "" {
+			return c.Host
+		}
+	}
+
+	return ""
+}
+
+// IsGeneric returns true if variant is not specific to any host.
+func (v Variant) IsGeneric() bool {
+	return v.Host() == ""
+}
+
+// IsCopy returns true if file must be copied instead of symlinked.
+func (v Variant) IsCopy() bool {
+	for _, c := range v.Components {
+		if c.Copy {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsHardlink returns true if file must be hard linked instead of symlinked.
+func (v Variant) IsHardlink() bool {
+	for _, c := range v.Components {
+		if c.Hardlink {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsFor returns true if variant is used on host with given name.
+func (v Variant) IsFor(host string) bool {
+	return v.IsGeneric() || v.Host() == host
+}
+
+// IsSymlink returns true if file records target of symlink instead of being
+// linked.
+func (v Variant) IsSymlink() bool {
+	return len(v.Components) > 0 && v.Components[len(v.Components)-1].Symlink
+}
+
+// WithoutCopy returns the same variant with copy suffixes removed.
+func (v Variant) WithoutCopy() Variant {
+	result := Variant{Components: make([]Component, len(v.Components))}
+
+	for i, c := range v.Components {
+		c.Copy = false
+		result.Components[i] = c
+	}
+
+	return result
+}
@@ -0,0 +1,13 @@
+package variant_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestVariant(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Variant Suite")
+}
@@ -0,0 +1,191 @@
+package variant_test
+
+import (
+	. "github.com/vderyagin/dfm/variant"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Variant", func() {
+	Describe("ParseComponent", func() {
+		It("parses plain names", func() {
+			Expect(ParseComponent("bashrc")).To(Equal(Component{Name: "bashrc"}))
+		})
+
+		It("parses host suffix", func() {
+			Expect(ParseComponent("bashrc.host-my-laptop")).To(Equal(Component{Name: "bashrc", Host: "my-laptop"}))
+		})
+
+		It("parses suffixes in any order", func() {
+			expected := Component{Name: "bashrc", Host: "foo", Copy: true}
+
+			Expect(ParseComponent("bashrc.host-foo.force-copy")).To(Equal(expected))
+			Expect(ParseComponent("bashrc.force-copy.host-foo")).To(Equal(expected))
+		})
+
+		It("parses symlink suffix", func() {
+			Expect(ParseComponent("fonts.dfm-symlink.host-foo")).To(Equal(Component{Name: "fonts", Host: "foo", Symlink: true}))
+		})
+
+		It("does not take names merely ending with \"symlink\" for symlinks", func() {
+			Expect(ParseComponent("gitconfig.symlink")).To(Equal(Component{Name: "gitconfig.symlink"}))
+		})
+
+		It("parses hardlink suffix", func() {
+			Expect(ParseComponent("gitconfig.hardlink.host-foo")).To(Equal(Component{Name: "gitconfig", Host: "foo", Hardlink: true}))
+		})
+
+		It("rejects hard links that are also copies or symlinks", func() {
+			_, err := ParseComponent("gitconfig.hardlink.force-copy")
+			Expect(err).NotTo(Succeed())
+
+			_, err = ParseComponent("fonts.hardlink.dfm-symlink")
+			Expect(err).NotTo(Succeed())
+		})
+
+		It("rejects copied symlinks", func() {
+			_, err := ParseComponent("fonts.dfm-symlink.force-copy")
+			Expect(err).NotTo(Succeed())
+		})
+
+		It("rejects duplicate suffixes", func() {
+			_, err := ParseComponent("bashrc.force-copy.force-copy")
+			Expect(err).NotTo(Succeed())
+
+			_, err = ParseComponent("bashrc.host-foo.host-bar")
+			Expect(err).NotTo(Succeed())
+		})
+
+		It("rejects suffixes in the middle of name", func() {
+			_, err := ParseComponent("bashrc.host-foo.bak")
+			Expect(err).NotTo(Succeed())
+
+			_, err = ParseComponent("bashrc.force-copy.bak")
+			Expect(err).NotTo(Succeed())
+		})
+
+		It("accepts host names with underscores", func() {
+			Expect(ParseComponent("bashrc.host-my_laptop")).To(Equal(Component{Name: "bashrc", Host: "my_laptop"}))
+		})
+
+		It("rejects empty host name", func() {
+			_, err := ParseComponent("bashrc.host-")
+			Expect(err).NotTo(Succeed())
+		})
+
+		It("rejects suffixes without name", func() {
+			_, err := ParseComponent(".force-copy")
+			Expect(err).NotTo(Succeed())
+		})
+	})
+
+	Describe("Parse", func() {
+		It("parses suffixes of every component", func() {
+			v, err := Parse("config/i3.host-foo/config.force-copy")
+
+			Expect(err).To(Succeed())
+			Expect(v.Base()).To(Equal("config/i3/config"))
+			Expect(v.Host()).To(Equal("foo"))
+			Expect(v.IsCopy()).To(BeTrue())
+			Expect(v.IsGeneric()).To(BeFalse())
+			Expect(v.Path()).To(Equal("config/i3.host-foo/config.force-copy"))
+		})
+
+		It("parses absolute paths", func() {
+			v, err := Parse("/store/bashrc.host-foo")
+
+			Expect(err).To(Succeed())
+			Expect(v.Base()).To(Equal("/store/bashrc"))
+			Expect(v.Path()).To(Equal("/store/bashrc.host-foo"))
+		})
+
+		It("accepts the same host on several components", func() {
+			v, err := Parse("i3.host-foo/config.host-foo")
+
+			Expect(err).To(Succeed())
+			Expect(v.Host()).To(Equal("foo"))
+		})
+
+		It("rejects suffixes of different hosts", func() {
+			_, err := Parse("i3.host-foo/config.host-bar")
+			Expect(err).NotTo(Succeed())
+		})
+
+		It("parses symlink files", func() {
+			v, err := Parse("local/share/fonts.host-foo.dfm-symlink")
+
+			Expect(err).To(Succeed())
+			Expect(v.IsSymlink()).To(BeTrue())
+			Expect(v.Base()).To(Equal("local/share/fonts"))
+		})
+
+		It("applies hardlink suffix of directory to files in it", func() {
+			v, err := Parse("config.hardlink/app/settings")
+
+			Expect(err).To(Succeed())
+			Expect(v.IsHardlink()).To(BeTrue())
+			Expect(v.Base()).To(Equal("config/app/settings"))
+		})
+
+		It("rejects copies in hard linked directories", func() {
+			_, err := Parse("config.hardlink/settings.force-copy")
+			Expect(err).NotTo(Succeed())
+		})
+
+		It("rejects symlink suffix on directories", func() {
+			_, err := Parse("local.dfm-symlink/fonts")
+			Expect(err).NotTo(Succeed())
+		})
+
+		It("rejects symlinks in force-copy directories", func() {
+			_, err := Parse("local.force-copy/fonts.dfm-symlink")
+			Expect(err).NotTo(Succeed())
+		})
+
+		It("rejects malformed components", func() {
+			_, err := Parse("i3.host-foo.bak/config")
+			Expect(err).NotTo(Succeed())
+		})
+	})
+
+	Describe("IsFor", func() {
+		It("returns true for generic variants", func() {
+			v, _ := Parse("bashrc.force-copy")
+			Expect(v.IsFor("foo")).To(BeTrue())
+		})
+
+		It("returns true for variants specific to given host", func() {
+			v, _ := Parse("bashrc.host-foo")
+			Expect(v.IsFor("foo")).To(BeTrue())
+			Expect(v.IsFor("bar")).To(BeFalse())
+		})
+	})
+
+	Describe("CheckHost", func() {
+		It("accepts host names that can be put in suffixes", func() {
+			Expect(CheckHost("my-laptop_2")).To(Succeed())
+		})
+
+		It("rejects host names with dots", func() {
+			Expect(CheckHost("foo.local")).NotTo(Succeed())
+		})
+	})
+
+	Describe("New", func() {
+		It("puts suffixes on file name, host suffix first", func() {
+			Expect(New("config/git/config", "foo", true).Path()).To(Equal("config/git/config.host-foo.force-copy"))
+		})
+
+		It("returns generic variant", func() {
+			Expect(New("config/git/config", "", false).Path()).To(Equal("config/git/config"))
+		})
+	})
+
+	Describe("WithoutCopy", func() {
+		It("removes copy suffixes from every component", func() {
+			v, _ := Parse("app.force-copy/settings.host-foo.force-copy")
+			Expect(v.WithoutCopy().Path()).To(Equal("app/settings.host-foo"))
+		})
+	})
+})